@@ -1,6 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -16,41 +22,84 @@ import (
 
 	"github.com/RunzhiZhao/long-gate/internal/admin"
 	"github.com/RunzhiZhao/long-gate/internal/balancer"
+	"github.com/RunzhiZhao/long-gate/internal/discovery"
 	"github.com/RunzhiZhao/long-gate/internal/etcdv3"
 	"github.com/RunzhiZhao/long-gate/internal/middleware"
 	"github.com/RunzhiZhao/long-gate/internal/router"
+	"github.com/RunzhiZhao/long-gate/internal/store"
 	"github.com/RunzhiZhao/long-gate/internal/upstream"
 )
 
 // Gateway 网关核心
 type Gateway struct {
-	router        *router.Router
-	watcher       *etcdv3.ConfigWatcher
-	healthChecker *upstream.HealthChecker
-	adminAPI      *admin.AdminAPI
-	logger        *zap.Logger
-
-	// 中间件链
-	globalChain *middleware.Chain
+	router          *router.Router
+	watcher         *etcdv3.ConfigWatcher
+	healthChecker   *upstream.HealthChecker
+	clusterHealth   *upstream.ClusterHealth // 未启用集群共享健康检查时为 nil
+	outlierDetector *upstream.OutlierDetector
+	balancers       *balancer.Cache
+	discovery       *discovery.Manager
+	adminAPI        *admin.AdminAPI
+	logger          *zap.Logger
 }
 
 func main() {
+	zone := flag.String("zone", os.Getenv("LONG_GATE_ZONE"), "gateway availability zone, used by locality-aware load balancing")
+	region := flag.String("region", os.Getenv("LONG_GATE_REGION"), "gateway region, used by locality-aware load balancing")
+	configFile := flag.String("config", "", "run in standalone mode with routes and upstreams from a YAML/JSON file instead of etcd")
+	sharedHealth := flag.Bool("shared-health", false, "elect a leader through etcd to run active health checks and share results across gateway nodes")
+	nodeID := flag.String("node-id", "", "gateway node id used in health leader election, defaults to hostname and pid")
+	snapshotFile := flag.String("snapshot", "", "path of a local snapshot of the last synced etcd config (e.g. /var/lib/long-gate/snapshot.json), used to start when etcd is unavailable; disabled when empty")
+	flag.Parse()
+
 	// 初始化日志
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
-	// 连接 ETCD
-	etcdClient, err := clientv3.New(clientv3.Config{
-		Endpoints:   []string{"localhost:2379"},
-		DialTimeout: 5 * time.Second,
-	})
-	if err != nil {
-		logger.Fatal("failed to connect to etcd", zap.Error(err))
+	// 网关所在地域/可用区
+	config.SetLocalLocality(config.Locality{Region: *region, Zone: *zone})
+
+	// 创建配置存储：单机模式使用本地文件，否则连接 ETCD
+	var configStore store.ConfigStore
+	var etcdClient *clientv3.Client
+	if *configFile != "" {
+		fileStore := store.NewFileStore(*configFile, logger)
+		if err := fileStore.Start(); err != nil {
+			logger.Fatal("failed to load config file", zap.Error(err))
+		}
+		defer fileStore.Stop()
+		configStore = fileStore
+	} else {
+		var err error
+		etcdClient, err = clientv3.New(clientv3.Config{
+			Endpoints:   []string{"localhost:2379"},
+			DialTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			logger.Fatal("failed to connect to etcd", zap.Error(err))
+		}
+		defer etcdClient.Close()
+		configStore = store.NewEtcdStore(etcdClient)
 	}
-	defer etcdClient.Close()
 
 	// 创建网关实例
-	gateway := NewGateway(etcdClient, logger)
+	gateway := NewGateway(configStore, logger)
+	if *configFile == "" && *snapshotFile != "" {
+		gateway.watcher.SetSnapshotPath(*snapshotFile)
+	}
+
+	// 集群共享健康检查
+	if *sharedHealth {
+		if etcdClient == nil {
+			logger.Fatal("shared health requires etcd and is not available in standalone mode")
+		}
+		node := *nodeID
+		if node == "" {
+			hostname, _ := os.Hostname()
+			node = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+		gateway.clusterHealth = upstream.NewClusterHealth(etcdClient, gateway.healthChecker, node, logger)
+	}
 
 	// 启动服务
 	if err := gateway.Start(); err != nil {
@@ -67,46 +116,69 @@ func main() {
 }
 
 // NewGateway 创建网关实例
-func NewGateway(etcdClient *clientv3.Client, logger *zap.Logger) *Gateway {
+func NewGateway(configStore store.ConfigStore, logger *zap.Logger) *Gateway {
 	// 创建路由引擎
 	r := router.NewRouter()
 
 	// 创建配置监听器
-	watcher := etcdv3.NewConfigWatcher(etcdClient, r, logger)
+	watcher := etcdv3.NewConfigWatcher(configStore, r, logger)
 
 	// 创建健康检查器
 	healthChecker := upstream.NewHealthChecker(logger)
+	watcher.AddUpstreamListener(healthChecker)
+
+	// 创建异常节点检测器
+	outlierDetector := upstream.NewOutlierDetector(logger)
+	watcher.AddUpstreamListener(outlierDetector)
+
+	// 创建服务发现管理器
+	discoveryManager := discovery.NewManager(logger)
+	watcher.AddUpstreamListener(discoveryManager)
+
+	// 创建负载均衡器缓存
+	balancers := balancer.NewCache()
+	watcher.AddUpstreamListener(balancers)
 
 	// 创建管理 API
-	adminAPI := admin.NewAdminAPI(etcdClient, r, logger)
+	adminAPI := admin.NewAdminAPI(configStore, r, watcher, watcher, logger)
+
+	g := &Gateway{
+		router:          r,
+		watcher:         watcher,
+		healthChecker:   healthChecker,
+		outlierDetector: outlierDetector,
+		balancers:       balancers,
+		discovery:       discoveryManager,
+		adminAPI:        adminAPI,
+		logger:          logger,
+	}
 
-	// 创建全局中间件链
+	// 全局中间件链，与路由插件和转发处理器在加载路由时编译为完整处理器
 	globalChain := middleware.NewChain(
 		middleware.Recovery(logger),
 		middleware.Logger(logger),
 		middleware.RequestID(),
 		middleware.CORS(),
 	)
+	r.SetHandler(globalChain, g.routeHandler)
 
-	return &Gateway{
-		router:        r,
-		watcher:       watcher,
-		healthChecker: healthChecker,
-		adminAPI:      adminAPI,
-		logger:        logger,
-		globalChain:   globalChain,
-	}
+	return g
 }
 
 // Start 启动网关
 func (g *Gateway) Start() error {
-	// 1. 启动配置监听
+	// 1. 启动服务发现和配置监听
+	g.discovery.Start()
 	if err := g.watcher.Start(); err != nil {
 		return err
 	}
 
-	// 2. 启动健康检查
+	// 2. 启动健康检查和异常检测
 	g.healthChecker.Start()
+	if g.clusterHealth != nil {
+		g.clusterHealth.Start()
+	}
+	g.outlierDetector.Start()
 
 	// 3. 启动管理 API (端口 9000)
 	go func() {
@@ -130,7 +202,12 @@ func (g *Gateway) Start() error {
 // Stop 停止网关
 func (g *Gateway) Stop() {
 	g.watcher.Stop()
+	g.discovery.Stop()
+	if g.clusterHealth != nil {
+		g.clusterHealth.Stop()
+	}
 	g.healthChecker.Stop()
+	g.outlierDetector.Stop()
 }
 
 // ServeHTTP 处理请求（数据面核心）
@@ -138,8 +215,11 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 创建上下文
 	ctx := middleware.NewContext(w, r, g.logger)
 
+	// 获取配置快照，同一请求内的路由和上游来自同一代配置
+	snapshot := g.router.Snapshot()
+
 	// 匹配路由
-	route, params := g.router.Match(r)
+	route, params := snapshot.Match(r)
 	if route == nil {
 		http.Error(w, "404 Not Found", http.StatusNotFound)
 		return
@@ -148,67 +228,235 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 设置路径参数
 	ctx.Params = params
 
-	// 获取上游服务
-	upstream, ok := g.watcher.GetUpstream(route.UpstreamID)
-	if !ok {
-		http.Error(w, "503 Upstream Not Found", http.StatusServiceUnavailable)
-		return
+	// 执行加载路由时编译好的处理器：全局中间件 -> 路由插件 -> 转发
+	snapshot.Handler(route)(ctx)
+}
+
+// errFallback 上游返回了触发降级的状态码
+var errFallback = errors.New("upstream returned fallback status")
+
+// routeHandler 路由处理器，依次尝试主上游和降级上游
+func (g *Gateway) routeHandler(route *config.Route, snapshot *router.RouteTable) middleware.HandlerFunc {
+	return func(ctx *middleware.Context) {
+		fallback := route.Fallback
+		if fallback == nil {
+			upstream, ok := snapshot.Upstream(route.UpstreamID)
+			if !ok {
+				http.Error(ctx.Response, "503 Upstream Not Found", http.StatusServiceUnavailable)
+				return
+			}
+			g.forward(ctx, upstream, nil)
+			return
+		}
+
+		// 缓存请求体，以便切换上游时重放；超过上限时不缓存，也不再尝试备用上游
+		body, replayable, err := bufferBody(ctx.Request, fallback.MaxBodyBytes)
+		if err != nil {
+			http.Error(ctx.Response, "400 Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		upstreamIDs := []string{route.UpstreamID}
+		if replayable {
+			upstreamIDs = append(upstreamIDs, fallback.UpstreamIDs...)
+		} else {
+			g.logger.Debug("request body too large to replay, skipping fallback upstreams",
+				zap.String("route", route.ID),
+				zap.Int64("max_body_bytes", fallback.MaxBodyBytes))
+		}
+		for i, id := range upstreamIDs {
+			upstream, ok := snapshot.Upstream(id)
+			if !ok {
+				g.logger.Warn("fallback upstream not found",
+					zap.String("route", route.ID),
+					zap.String("upstream", id))
+				continue
+			}
+
+			// 最后一个上游且没有静态响应时，直接返回该上游的结果
+			var shouldFallback func(status int) bool
+			if i < len(upstreamIDs)-1 || fallback.Response != nil {
+				shouldFallback = fallback.MatchStatus
+			}
+
+			if body != nil {
+				ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			if g.forward(ctx, upstream, shouldFallback) {
+				return
+			}
+			g.logger.Warn("upstream failed, falling back",
+				zap.String("route", route.ID),
+				zap.String("upstream", id))
+		}
+
+		// 降级链耗尽
+		if resp := fallback.Response; resp != nil {
+			for key, value := range resp.Headers {
+				ctx.Response.Header().Set(key, value)
+			}
+			ctx.Response.WriteHeader(resp.Status)
+			ctx.Response.Write([]byte(resp.Body))
+			return
+		}
+		http.Error(ctx.Response, "503 No Available Upstream", http.StatusServiceUnavailable)
 	}
+}
 
-	// 构建处理器链
-	finalHandler := g.proxyHandler(upstream)
-	handler := g.globalChain.Then(finalHandler)
+// bufferBody 缓存不超过 limit 字节的请求体，返回缓存内容和请求体是否可重放
+// 请求体超过 limit 时不再继续读取，已读取的部分与剩余部分重新拼接为 Body 正常转发一次
+func bufferBody(r *http.Request, limit int64) ([]byte, bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if r.ContentLength > limit {
+		return nil, false, nil
+	}
 
-	// 执行
-	handler(ctx)
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false, nil
+	}
+	r.Body.Close()
+	return body, true, nil
 }
 
-// proxyHandler 反向代理处理器
-func (g *Gateway) proxyHandler(upstream *config.Upstream) middleware.HandlerFunc {
-	return func(ctx *middleware.Context) {
-		// 创建负载均衡器
-		lb := balancer.NewLoadBalancer(upstream.Type, upstream)
+// readCloser 组合读取和关闭
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
 
-		// 选择目标节点
-		clientIP := ctx.Request.RemoteAddr
-		target, err := lb.Select(clientIP)
+// selectAttempts 选中的半开节点名额被并发请求占满时重新选择的次数上限
+const selectAttempts = 3
+
+// selectTarget 选择目标节点（启用会话保持时优先使用亲和 Cookie）并增加其活跃连接数
+// 半开节点的探测名额在增加连接数时才原子占用，占用失败说明名额已被并发请求占满，
+// 此时该节点已不可选，重新选择即可选到其他节点
+func selectTarget(ctx *middleware.Context, upstream *config.Upstream, lb balancer.LoadBalancer) (*config.Target, *http.Cookie, error) {
+	key := balancer.HashKey(ctx, upstream.HashOn)
+	for i := 0; i < selectAttempts; i++ {
+		var target *config.Target
+		var affinity *http.Cookie
+		var err error
+		if upstream.StickySession != nil && upstream.StickySession.Enabled {
+			target, affinity, err = balancer.SelectSticky(ctx.Request, upstream, lb, key)
+		} else {
+			target, err = lb.Select(key)
+		}
 		if err != nil {
-			http.Error(ctx.Response, "503 No Healthy Target", http.StatusServiceUnavailable)
-			return
+			return nil, nil, err
+		}
+		if upstream.IncrementActiveConns(target.Address) {
+			return target, affinity, nil
 		}
+	}
+	return nil, nil, balancer.ErrNoHealthyTarget
+}
 
-		// 增加活跃连接数
-		upstream.IncrementActiveConns(target.Address)
-		defer upstream.DecrementActiveConns(target.Address)
+// forward 将请求转发到上游，返回是否已写入响应
+// shouldFallback 不为 nil 时，没有可选节点、连接错误或状态码命中时不写响应并返回 false
+func (g *Gateway) forward(ctx *middleware.Context, upstream *config.Upstream, shouldFallback func(status int) bool) bool {
+	// 获取负载均衡器
+	lb := g.balancers.Get(upstream)
 
-		// 构建目标 URL
-		targetURL, _ := url.Parse("http://" + target.Address)
+	// 选择目标节点并增加活跃连接数
+	target, affinity, err := selectTarget(ctx, upstream, lb)
+	if err != nil {
+		if shouldFallback != nil {
+			return false
+		}
+		http.Error(ctx.Response, "503 No Healthy Target", http.StatusServiceUnavailable)
+		return true
+	}
+	defer upstream.DecrementActiveConns(target.Address)
+
+	// 构建目标 URL
+	targetURL, _ := url.Parse("http://" + target.Address)
+
+	// 创建反向代理
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+
+	// 上报响应结果（驱动熔断、被动健康检查和异常检测）
+	start := time.Now()
+	fellBack := false
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		g.reportResult(upstream, target, config.ProxyResult{
+			StatusCode: resp.StatusCode,
+			Latency:    time.Since(start),
+		})
+		if shouldFallback != nil && shouldFallback(resp.StatusCode) {
+			return errFallback
+		}
+		if affinity != nil {
+			resp.Header.Add("Set-Cookie", affinity.String())
+		}
+		return nil
+	}
 
-		// 创建反向代理
-		proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	// 自定义错误处理
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, errFallback) {
+			fellBack = true
+			return
+		}
 
-		// 自定义错误处理
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			g.logger.Error("proxy error",
-				zap.String("target", target.Address),
-				zap.Error(err))
-			http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		g.logger.Error("proxy error",
+			zap.String("target", target.Address),
+			zap.Error(err))
+		// 客户端主动取消不计入节点失败，也不再降级，但仍需上报以归还半开探测名额
+		canceled := errors.Is(err, context.Canceled)
+		g.reportResult(upstream, target, config.ProxyResult{
+			Latency:  time.Since(start),
+			Canceled: canceled,
+		})
+		if shouldFallback != nil && !canceled {
+			fellBack = true
+			return
 		}
+		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+	}
 
-		// 修改请求
-		proxy.Director = func(req *http.Request) {
-			req.URL.Scheme = targetURL.Scheme
-			req.URL.Host = targetURL.Host
-			req.Host = targetURL.Host
+	// 修改请求
+	proxy.Director = func(req *http.Request) {
+		req.URL.Scheme = targetURL.Scheme
+		req.URL.Host = targetURL.Host
+		req.Host = target.Host()
 
-			// 添加 X-Forwarded 头
-			if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-				req.Header.Set("X-Forwarded-For", clientIP)
-			}
-			req.Header.Set("X-Forwarded-Proto", "http")
+		// 添加 X-Forwarded 头
+		if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+			req.Header.Set("X-Forwarded-For", clientIP)
 		}
+		req.Header.Set("X-Forwarded-Proto", "http")
+	}
 
-		// 执行代理
-		proxy.ServeHTTP(ctx.Response, ctx.Request)
+	// 执行代理
+	proxy.ServeHTTP(ctx.Response, ctx.Request)
+	return !fellBack
+}
+
+// reportResult 上报代理结果，驱动节点熔断器和被动健康检查
+func (g *Gateway) reportResult(upstream *config.Upstream, target *config.Target, result config.ProxyResult) {
+	effect := upstream.ReportResult(target.Address, result)
+	if effect.BreakerChanged {
+		g.logger.Warn("circuit breaker state changed",
+			zap.String("upstream", upstream.ID),
+			zap.String("target", target.Address),
+			zap.String("state", string(effect.BreakerState)))
+	}
+	if effect.MarkedUnhealthy {
+		g.logger.Warn("target became unhealthy by passive check",
+			zap.String("upstream", upstream.ID),
+			zap.String("target", target.Address),
+			zap.Int("fail_count", effect.FailCount))
+	}
+	if effect.Recovered {
+		g.logger.Info("target recovered by passive check",
+			zap.String("upstream", upstream.ID),
+			zap.String("target", target.Address))
 	}
 }
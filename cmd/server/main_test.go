@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBufferBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64 // -1 表示分块传输（长度未知）
+		replayable    bool
+	}{
+		{name: "empty", replayable: true},
+		{name: "within limit", body: "hello", contentLength: 5, replayable: true},
+		{name: "exactly limit", body: "0123456789", contentLength: 10, replayable: true},
+		{name: "declared too large", body: "0123456789abc", contentLength: 13},
+		{name: "chunked too large", body: "0123456789abc", contentLength: -1},
+		{name: "chunked within limit", body: "hello", contentLength: -1, replayable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.body == "" {
+				r.Body = http.NoBody
+			}
+			r.ContentLength = tt.contentLength
+
+			body, replayable, err := bufferBody(r, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replayable != tt.replayable {
+				t.Fatalf("replayable = %v, want %v", replayable, tt.replayable)
+			}
+			if replayable {
+				if string(body) != tt.body {
+					t.Fatalf("buffered %q, want %q", body, tt.body)
+				}
+				return
+			}
+
+			// 不可重放时请求体完整保留，仍可转发一次
+			rest, err := io.ReadAll(r.Body)
+			if err != nil || string(rest) != tt.body {
+				t.Fatalf("forwarded body %q (err %v), want %q", rest, err, tt.body)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ go 1.25.3
 
 require (
 	github.com/fsnotify/fsnotify v1.9.0
-	golang.org/x/time v0.14.0
+	google.golang.org/grpc v1.71.1
 )
 
 require (
@@ -20,7 +20,6 @@ require (
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250303144028-a0af3efb3deb // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250303144028-a0af3efb3deb // indirect
-	google.golang.org/grpc v1.71.1 // indirect
 	google.golang.org/protobuf v1.36.5 // indirect
 )
 
@@ -2,33 +2,50 @@ package admin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
-	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 
 	"github.com/RunzhiZhao/long-gate/internal/config"
-	"github.com/RunzhiZhao/long-gate/internal/etcdv3"
+	"github.com/RunzhiZhao/long-gate/internal/plugin"
 	"github.com/RunzhiZhao/long-gate/internal/router"
+	"github.com/RunzhiZhao/long-gate/internal/store"
 )
 
+// UpstreamProvider 运行时上游服务提供者
+type UpstreamProvider interface {
+	GetUpstream(id string) (*config.Upstream, bool)
+}
+
+// ConfigStatus 配置同步状态
+type ConfigStatus interface {
+	// Degraded 配置存储不可用，网关正在使用本地快照提供服务
+	Degraded() bool
+}
+
 // AdminAPI 管理 API 服务器
 type AdminAPI struct {
-	etcdClient *clientv3.Client
-	router     *router.Router
-	logger     *zap.Logger
-	mux        *http.ServeMux
+	store     store.ConfigStore
+	router    *router.Router
+	upstreams UpstreamProvider
+	status    ConfigStatus
+	logger    *zap.Logger
+	mux       *http.ServeMux
 }
 
 // NewAdminAPI 创建管理 API
-func NewAdminAPI(etcdClient *clientv3.Client, r *router.Router, logger *zap.Logger) *AdminAPI {
+func NewAdminAPI(configStore store.ConfigStore, r *router.Router, upstreams UpstreamProvider, status ConfigStatus, logger *zap.Logger) *AdminAPI {
 	api := &AdminAPI{
-		etcdClient: etcdClient,
-		router:     r,
-		logger:     logger,
-		mux:        http.NewServeMux(),
+		store:     configStore,
+		router:    r,
+		upstreams: upstreams,
+		status:    status,
+		logger:    logger,
+		mux:       http.NewServeMux(),
 	}
 	api.setupRoutes()
 	return api
@@ -44,12 +61,20 @@ func (api *AdminAPI) setupRoutes() {
 	api.mux.HandleFunc("/admin/upstreams", api.handleUpstreams)
 	api.mux.HandleFunc("/admin/upstreams/", api.handleUpstreamByID)
 
+	// 插件
+	api.mux.HandleFunc("/admin/plugins", api.handlePlugins)
+
 	// 健康检查
 	api.mux.HandleFunc("/admin/health", api.handleHealth)
 }
 
 // ServeHTTP 实现 http.Handler
+// 降级模式下配置存储不可用，写入配置的请求直接返回 503，只读请求照常处理
 func (api *AdminAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if api.status.Degraded() && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Config store unavailable, gateway is in degraded mode", http.StatusServiceUnavailable)
+		return
+	}
 	api.mux.ServeHTTP(w, r)
 }
 
@@ -91,6 +116,9 @@ func (api *AdminAPI) handleRouteByID(w http.ResponseWriter, r *http.Request) {
 // listRoutes 获取路由列表
 func (api *AdminAPI) listRoutes(w http.ResponseWriter, r *http.Request) {
 	routes := api.router.ListRoutes()
+	for i, route := range routes {
+		routes[i] = redactRoute(route)
+	}
 	api.respondJSON(w, http.StatusOK, map[string]interface{}{
 		"total": len(routes),
 		"data":  routes,
@@ -104,7 +132,7 @@ func (api *AdminAPI) getRoute(w http.ResponseWriter, r *http.Request, routeID st
 		http.Error(w, "Route not found", http.StatusNotFound)
 		return
 	}
-	api.respondJSON(w, http.StatusOK, route)
+	api.respondJSON(w, http.StatusOK, redactRoute(route))
 }
 
 // createRoute 创建路由
@@ -125,21 +153,21 @@ func (api *AdminAPI) createRoute(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
 		return
 	}
+	if err := plugin.Validate(route.Plugins); err != nil {
+		http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	// 保存到 ETCD
+	// 保存到配置存储
 	data, _ := route.ToJSON()
-	key := etcdv3.RoutePrefix + route.ID
-
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
+	key := store.RoutePrefix + route.ID
 
-	if _, err := api.etcdClient.Put(ctx, key, string(data)); err != nil {
-		api.logger.Error("failed to save route to etcd", zap.Error(err))
-		http.Error(w, "Failed to save route", http.StatusInternalServerError)
+	if _, err := api.store.Put(r.Context(), key, data); err != nil {
+		api.respondStoreError(w, err, "Failed to save route")
 		return
 	}
 
-	api.respondJSON(w, http.StatusCreated, route)
+	api.respondJSON(w, http.StatusCreated, redactRoute(&route))
 }
 
 // updateRoute 更新路由
@@ -153,37 +181,41 @@ func (api *AdminAPI) updateRoute(w http.ResponseWriter, r *http.Request, routeID
 	route.ID = routeID
 	route.UpdateTime = time.Now().Unix()
 
+	// 提交的是脱敏后的插件密钥时保留已存储的密钥
+	key := store.RoutePrefix + route.ID
+	if len(route.Plugins) > 0 {
+		var stored config.Route
+		if kv, err := api.store.Get(r.Context(), key); err == nil {
+			json.Unmarshal(kv.Value, &stored)
+		}
+		plugin.Restore(route.Plugins, stored.Plugins, redactedSecret)
+	}
+
 	if err := route.Validate(); err != nil {
 		http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
 		return
 	}
+	if err := plugin.Validate(route.Plugins); err != nil {
+		http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	// 更新到 ETCD
+	// 更新到配置存储
 	data, _ := route.ToJSON()
-	key := etcdv3.RoutePrefix + route.ID
-
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
-
-	if _, err := api.etcdClient.Put(ctx, key, string(data)); err != nil {
-		api.logger.Error("failed to update route in etcd", zap.Error(err))
-		http.Error(w, "Failed to update route", http.StatusInternalServerError)
+	if _, err := api.store.Put(r.Context(), key, data); err != nil {
+		api.respondStoreError(w, err, "Failed to update route")
 		return
 	}
 
-	api.respondJSON(w, http.StatusOK, route)
+	api.respondJSON(w, http.StatusOK, redactRoute(&route))
 }
 
 // deleteRoute 删除路由
 func (api *AdminAPI) deleteRoute(w http.ResponseWriter, r *http.Request, routeID string) {
-	key := etcdv3.RoutePrefix + routeID
-
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
+	key := store.RoutePrefix + routeID
 
-	if _, err := api.etcdClient.Delete(ctx, key); err != nil {
-		api.logger.Error("failed to delete route from etcd", zap.Error(err))
-		http.Error(w, "Failed to delete route", http.StatusInternalServerError)
+	if err := api.store.Delete(r.Context(), key); err != nil {
+		api.respondStoreError(w, err, "Failed to delete route")
 		return
 	}
 
@@ -208,12 +240,17 @@ func (api *AdminAPI) handleUpstreams(w http.ResponseWriter, r *http.Request) {
 
 // handleUpstreamByID 处理单个上游
 func (api *AdminAPI) handleUpstreamByID(w http.ResponseWriter, r *http.Request) {
-	upstreamID := r.URL.Path[len("/admin/upstreams/"):]
+	upstreamID, sub, _ := strings.Cut(r.URL.Path[len("/admin/upstreams/"):], "/")
 	if upstreamID == "" {
 		http.Error(w, "Upstream ID required", http.StatusBadRequest)
 		return
 	}
 
+	if sub != "" {
+		api.handleUpstreamSubresource(w, r, upstreamID, sub)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		api.getUpstream(w, r, upstreamID)
@@ -226,23 +263,46 @@ func (api *AdminAPI) handleUpstreamByID(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// handleUpstreamSubresource 处理上游子资源
+// GET /admin/upstreams/:id/targets, GET /admin/upstreams/:id/health, GET /admin/upstreams/:id/ejections,
+// PUT /admin/upstreams/:id/weights
+func (api *AdminAPI) handleUpstreamSubresource(w http.ResponseWriter, r *http.Request, upstreamID, sub string) {
+	switch {
+	case sub == "targets" && r.Method == http.MethodGet:
+		api.getUpstreamTargets(w, r, upstreamID)
+	case sub == "health" && r.Method == http.MethodGet:
+		api.getUpstreamHealth(w, r, upstreamID)
+	case sub == "ejections" && r.Method == http.MethodGet:
+		api.getUpstreamEjections(w, r, upstreamID)
+	case sub == "weights" && r.Method == http.MethodPut:
+		api.updateUpstreamWeights(w, r, upstreamID)
+	case sub == "targets", sub == "health", sub == "ejections", sub == "weights":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 // listUpstreams 获取上游列表
 func (api *AdminAPI) listUpstreams(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
+	if api.status.Degraded() {
+		api.listRuntimeUpstreams(w)
+		return
+	}
 
-	resp, err := api.etcdClient.Get(ctx, etcdv3.UpstreamPrefix, clientv3.WithPrefix())
+	kvs, _, err := api.store.List(r.Context(), store.UpstreamPrefix)
 	if err != nil {
-		http.Error(w, "Failed to fetch upstreams", http.StatusInternalServerError)
+		api.respondStoreError(w, err, "Failed to fetch upstreams")
 		return
 	}
 
 	upstreams := make([]*config.Upstream, 0)
-	for _, kv := range resp.Kvs {
+	for _, kv := range kvs {
 		var u config.Upstream
 		if err := json.Unmarshal(kv.Value, &u); err != nil {
 			continue
 		}
+		redactUpstream(&u)
 		upstreams = append(upstreams, &u)
 	}
 
@@ -254,25 +314,180 @@ func (api *AdminAPI) listUpstreams(w http.ResponseWriter, r *http.Request) {
 
 // getUpstream 获取单个上游
 func (api *AdminAPI) getUpstream(w http.ResponseWriter, r *http.Request, upstreamID string) {
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
+	if api.status.Degraded() {
+		api.getRuntimeUpstream(w, upstreamID)
+		return
+	}
 
-	key := etcdv3.UpstreamPrefix + upstreamID
-	resp, err := api.etcdClient.Get(ctx, key)
-	if err != nil || len(resp.Kvs) == 0 {
+	kv, err := api.store.Get(r.Context(), store.UpstreamPrefix+upstreamID)
+	if err != nil {
 		http.Error(w, "Upstream not found", http.StatusNotFound)
 		return
 	}
 
 	var upstream config.Upstream
-	if err := json.Unmarshal(resp.Kvs[0].Value, &upstream); err != nil {
+	if err := json.Unmarshal(kv.Value, &upstream); err != nil {
 		http.Error(w, "Failed to parse upstream", http.StatusInternalServerError)
 		return
 	}
 
+	redactUpstream(&upstream)
+	api.respondJSON(w, http.StatusOK, &upstream)
+}
+
+// listRuntimeUpstreams 从当前生效的配置快照获取上游列表（降级模式）
+// 服务发现的上游展示的是当前解析出的节点
+func (api *AdminAPI) listRuntimeUpstreams(w http.ResponseWriter) {
+	upstreams := make([]*config.Upstream, 0)
+	for _, running := range api.router.ListUpstreams() {
+		upstream, err := copyUpstream(running)
+		if err != nil {
+			continue
+		}
+		upstreams = append(upstreams, upstream)
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total": len(upstreams),
+		"data":  upstreams,
+	})
+}
+
+// getRuntimeUpstream 从当前生效的配置快照获取单个上游（降级模式）
+func (api *AdminAPI) getRuntimeUpstream(w http.ResponseWriter, upstreamID string) {
+	running, ok := api.router.GetUpstream(upstreamID)
+	if !ok {
+		http.Error(w, "Upstream not found", http.StatusNotFound)
+		return
+	}
+	upstream, err := copyUpstream(running)
+	if err != nil {
+		http.Error(w, "Failed to parse upstream", http.StatusInternalServerError)
+		return
+	}
 	api.respondJSON(w, http.StatusOK, upstream)
 }
 
+// copyUpstream 复制正在服务的上游配置并隐藏敏感字段
+func copyUpstream(running *config.Upstream) (*config.Upstream, error) {
+	data, err := running.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	var upstream config.Upstream
+	if err := json.Unmarshal(data, &upstream); err != nil {
+		return nil, err
+	}
+	redactUpstream(&upstream)
+	return &upstream, nil
+}
+
+// getUpstreamTargets 获取上游节点的运行时状态（健康状态、熔断状态等）
+func (api *AdminAPI) getUpstreamTargets(w http.ResponseWriter, r *http.Request, upstreamID string) {
+	upstream, ok := api.upstreams.GetUpstream(upstreamID)
+	if !ok {
+		http.Error(w, "Upstream not found", http.StatusNotFound)
+		return
+	}
+
+	targets := upstream.TargetStates()
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total": len(targets),
+		"panic": upstream.InPanic(),
+		"data":  targets,
+	})
+}
+
+// getUpstreamHealth 获取节点健康状态和最近的主动探测记录
+func (api *AdminAPI) getUpstreamHealth(w http.ResponseWriter, r *http.Request, upstreamID string) {
+	upstream, ok := api.upstreams.GetUpstream(upstreamID)
+	if !ok {
+		http.Error(w, "Upstream not found", http.StatusNotFound)
+		return
+	}
+
+	health := upstream.HealthHistory()
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total": len(health),
+		"data":  health,
+	})
+}
+
+// getUpstreamEjections 获取被异常检测摘除的节点
+func (api *AdminAPI) getUpstreamEjections(w http.ResponseWriter, r *http.Request, upstreamID string) {
+	upstream, ok := api.upstreams.GetUpstream(upstreamID)
+	if !ok {
+		http.Error(w, "Upstream not found", http.StatusNotFound)
+		return
+	}
+
+	ejections := upstream.Ejections()
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total": len(ejections),
+		"data":  ejections,
+	})
+}
+
+// updateUpstreamWeights 在线调整节点权重
+// 请求体为 {"address": weight}，写回配置存储后由配置监听器热更新，
+// 平滑加权轮询的当前权重会被继承，不会打乱流量分布
+func (api *AdminAPI) updateUpstreamWeights(w http.ResponseWriter, r *http.Request, upstreamID string) {
+	var weights map[string]int
+	if err := json.NewDecoder(r.Body).Decode(&weights); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	for address, weight := range weights {
+		if weight < 1 || weight > 100 {
+			http.Error(w, fmt.Sprintf("Invalid weight for %s: must be between 1 and 100", address), http.StatusBadRequest)
+			return
+		}
+	}
+
+	key := store.UpstreamPrefix + upstreamID
+	kv, err := api.store.Get(r.Context(), key)
+	if err != nil {
+		http.Error(w, "Upstream not found", http.StatusNotFound)
+		return
+	}
+
+	var upstream config.Upstream
+	if err := json.Unmarshal(kv.Value, &upstream); err != nil {
+		http.Error(w, "Failed to parse upstream", http.StatusInternalServerError)
+		return
+	}
+
+	for address, weight := range weights {
+		found := false
+		for _, target := range upstream.Targets {
+			if target.Address == address {
+				target.Weight = weight
+				found = true
+			}
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("Target not found: %s", address), http.StatusNotFound)
+			return
+		}
+	}
+	upstream.UpdateTime = time.Now().Unix()
+	upstream.Version++
+
+	// 基于版本号的乐观锁，避免覆盖并发修改
+	data, _ := upstream.ToJSON()
+	if _, err := api.store.CompareAndPut(r.Context(), key, data, kv.Revision); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			http.Error(w, "Upstream modified concurrently, please retry", http.StatusConflict)
+			return
+		}
+		api.respondStoreError(w, err, "Failed to update upstream weights")
+		return
+	}
+
+	redactUpstream(&upstream)
+	api.respondJSON(w, http.StatusOK, &upstream)
+}
+
 // createUpstream 创建上游
 func (api *AdminAPI) createUpstream(w http.ResponseWriter, r *http.Request) {
 	var upstream config.Upstream
@@ -291,17 +506,15 @@ func (api *AdminAPI) createUpstream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data, _ := upstream.ToJSON()
-	key := etcdv3.UpstreamPrefix + upstream.ID
+	key := store.UpstreamPrefix + upstream.ID
 
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
-
-	if _, err := api.etcdClient.Put(ctx, key, string(data)); err != nil {
-		http.Error(w, "Failed to save upstream", http.StatusInternalServerError)
+	if _, err := api.store.Put(r.Context(), key, data); err != nil {
+		api.respondStoreError(w, err, "Failed to save upstream")
 		return
 	}
 
-	api.respondJSON(w, http.StatusCreated, upstream)
+	redactUpstream(&upstream)
+	api.respondJSON(w, http.StatusCreated, &upstream)
 }
 
 // updateUpstream 更新上游
@@ -315,34 +528,39 @@ func (api *AdminAPI) updateUpstream(w http.ResponseWriter, r *http.Request, upst
 	upstream.ID = upstreamID
 	upstream.UpdateTime = time.Now().Unix()
 
+	// 提交的是脱敏后的密钥时保留已存储的密钥
+	key := store.UpstreamPrefix + upstream.ID
+	if upstream.StickySession != nil && upstream.StickySession.Secret == redactedSecret {
+		upstream.StickySession.Secret = ""
+		if kv, err := api.store.Get(r.Context(), key); err == nil {
+			var stored config.Upstream
+			if err := json.Unmarshal(kv.Value, &stored); err == nil && stored.StickySession != nil {
+				upstream.StickySession.Secret = stored.StickySession.Secret
+			}
+		}
+	}
+
 	if err := upstream.Validate(); err != nil {
 		http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusBadRequest)
 		return
 	}
 
 	data, _ := upstream.ToJSON()
-	key := etcdv3.UpstreamPrefix + upstream.ID
-
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
-
-	if _, err := api.etcdClient.Put(ctx, key, string(data)); err != nil {
-		http.Error(w, "Failed to update upstream", http.StatusInternalServerError)
+	if _, err := api.store.Put(r.Context(), key, data); err != nil {
+		api.respondStoreError(w, err, "Failed to update upstream")
 		return
 	}
 
-	api.respondJSON(w, http.StatusOK, upstream)
+	redactUpstream(&upstream)
+	api.respondJSON(w, http.StatusOK, &upstream)
 }
 
 // deleteUpstream 删除上游
 func (api *AdminAPI) deleteUpstream(w http.ResponseWriter, r *http.Request, upstreamID string) {
-	key := etcdv3.UpstreamPrefix + upstreamID
+	key := store.UpstreamPrefix + upstreamID
 
-	ctx, cancel := r.Context(), func() {}
-	defer cancel()
-
-	if _, err := api.etcdClient.Delete(ctx, key); err != nil {
-		http.Error(w, "Failed to delete upstream", http.StatusInternalServerError)
+	if err := api.store.Delete(r.Context(), key); err != nil {
+		api.respondStoreError(w, err, "Failed to delete upstream")
 		return
 	}
 
@@ -351,15 +569,73 @@ func (api *AdminAPI) deleteUpstream(w http.ResponseWriter, r *http.Request, upst
 	})
 }
 
+// --- 插件 ---
+
+// handlePlugins 获取已注册的插件及其配置字段
+func (api *AdminAPI) handlePlugins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	plugins := make([]map[string]interface{}, 0)
+	for _, p := range plugin.List() {
+		plugins = append(plugins, map[string]interface{}{
+			"name":     p.Name,
+			"priority": p.Priority,
+			"fields":   p.Fields(),
+		})
+	}
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"total": len(plugins),
+		"data":  plugins,
+	})
+}
+
 // --- 健康检查 ---
 
 // handleHealth 健康检查端点
+// 降级模式下网关仍按本地快照转发请求，返回 200 并标明 degraded
 func (api *AdminAPI) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if api.status.Degraded() {
+		api.respondJSON(w, http.StatusOK, map[string]string{
+			"status": "degraded",
+			"reason": "config store unavailable, serving from local snapshot",
+		})
+		return
+	}
 	api.respondJSON(w, http.StatusOK, map[string]string{
 		"status": "healthy",
 	})
 }
 
+// respondStoreError 响应配置存储错误，只读存储（单机模式）返回 405
+func (api *AdminAPI) respondStoreError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, store.ErrReadOnly) {
+		http.Error(w, "Config store is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+	api.logger.Error(strings.ToLower(message), zap.Error(err))
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// redactedSecret 响应中替代会话保持签名密钥和插件密钥的占位符，更新时原样提交表示保留原密钥
+const redactedSecret = "******"
+
+// redactRoute 返回隐藏插件敏感字段后的路由副本（路由可能正被路由表使用，不能修改）
+func redactRoute(route *config.Route) *config.Route {
+	redacted := *route
+	redacted.Plugins = plugin.Redact(route.Plugins, redactedSecret)
+	return &redacted
+}
+
+// redactUpstream 隐藏上游配置中的敏感字段
+func redactUpstream(upstream *config.Upstream) {
+	if upstream.StickySession != nil && upstream.StickySession.Secret != "" {
+		upstream.StickySession.Secret = redactedSecret
+	}
+}
+
 // respondJSON 响应 JSON
 func (api *AdminAPI) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,232 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/etcdv3"
+	"github.com/RunzhiZhao/long-gate/internal/router"
+	"github.com/RunzhiZhao/long-gate/internal/store"
+)
+
+// adminStep 一次管理 API 调用及期望结果
+type adminStep struct {
+	name       string
+	method     string
+	path       string
+	body       string
+	wantStatus int
+	wantBody   string // 响应中应包含的内容
+	denyBody   string // 响应中不应包含的内容
+	eventually bool   // 依赖配置监听器同步到路由表，允许重试
+}
+
+func newTestAPI(t *testing.T, configStore store.ConfigStore) *AdminAPI {
+	t.Helper()
+	r := router.NewRouter()
+	watcher := etcdv3.NewConfigWatcher(configStore, r, zap.NewNop())
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(watcher.Stop)
+	return NewAdminAPI(configStore, r, watcher, watcher, zap.NewNop())
+}
+
+func runSteps(t *testing.T, api http.Handler, steps []adminStep) {
+	t.Helper()
+	for _, step := range steps {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			ok := rec.Code == step.wantStatus &&
+				strings.Contains(body, step.wantBody) &&
+				(step.denyBody == "" || !strings.Contains(body, step.denyBody))
+			if ok {
+				break
+			}
+			if !step.eventually || time.Now().After(deadline) {
+				t.Fatalf("%s: %s %s = %d %s, want %d containing %q", step.name, step.method, step.path,
+					rec.Code, strings.TrimSpace(body), step.wantStatus, step.wantBody)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+const (
+	testUpstream = `{"id": "u1", "type": "round-robin", "targets": [{"address": "10.0.0.1:80"}, {"address": "10.0.0.2:80"}],
+		"sticky_session": {"enabled": true, "secret": "top-secret"}}`
+	testRoute = `{"id": "r1", "status": 1, "predicates": {"path": "/api"}, "upstream_id": "u1"}`
+)
+
+func TestAdminCRUD(t *testing.T) {
+	memory := store.NewMemoryStore()
+	api := newTestAPI(t, memory)
+
+	runSteps(t, api, []adminStep{
+		{name: "create upstream", method: http.MethodPost, path: "/admin/upstreams", body: testUpstream,
+			wantStatus: http.StatusCreated, wantBody: `"id":"u1"`, denyBody: "top-secret"},
+		{name: "invalid upstream", method: http.MethodPost, path: "/admin/upstreams", body: `{"id": "u2", "type": "round-robin"}`,
+			wantStatus: http.StatusBadRequest},
+		{name: "get upstream redacts secret", method: http.MethodGet, path: "/admin/upstreams/u1",
+			wantStatus: http.StatusOK, wantBody: `"secret":"******"`, denyBody: "top-secret"},
+		{name: "list upstreams redacts secret", method: http.MethodGet, path: "/admin/upstreams",
+			wantStatus: http.StatusOK, wantBody: `"total":1`, denyBody: "top-secret"},
+		{name: "update upstream keeps redacted secret", method: http.MethodPut, path: "/admin/upstreams/u1",
+			body:       strings.Replace(testUpstream, "top-secret", "******", 1),
+			wantStatus: http.StatusOK, denyBody: "top-secret"},
+		{name: "update weights", method: http.MethodPut, path: "/admin/upstreams/u1/weights", body: `{"10.0.0.1:80": 5}`,
+			wantStatus: http.StatusOK, wantBody: `"weight":5`},
+		{name: "invalid weight", method: http.MethodPut, path: "/admin/upstreams/u1/weights", body: `{"10.0.0.1:80": 0}`,
+			wantStatus: http.StatusBadRequest},
+		{name: "runtime targets", method: http.MethodGet, path: "/admin/upstreams/u1/targets",
+			wantStatus: http.StatusOK, wantBody: `"effective_weight":500`, eventually: true},
+
+		{name: "create route", method: http.MethodPost, path: "/admin/routes", body: testRoute,
+			wantStatus: http.StatusCreated, wantBody: `"id":"r1"`},
+		{name: "invalid route", method: http.MethodPost, path: "/admin/routes", body: `{"id": "r2"}`,
+			wantStatus: http.StatusBadRequest},
+		{name: "invalid route plugin", method: http.MethodPost, path: "/admin/routes",
+			body:       strings.Replace(testRoute, `"upstream_id"`, `"plugins": {"jwt": {}}, "upstream_id"`, 1),
+			wantStatus: http.StatusBadRequest, wantBody: "secret cannot be empty"},
+		{name: "unknown route plugin", method: http.MethodPut, path: "/admin/routes/r1",
+			body:       strings.Replace(testRoute, `"upstream_id"`, `"plugins": {"cors": {}}, "upstream_id"`, 1),
+			wantStatus: http.StatusBadRequest, wantBody: "unknown plugin: cors"},
+		{name: "get route", method: http.MethodGet, path: "/admin/routes/r1",
+			wantStatus: http.StatusOK, wantBody: `"upstream_id":"u1"`, eventually: true},
+		{name: "update route", method: http.MethodPut, path: "/admin/routes/r1", body: strings.Replace(testRoute, "/api", "/v2", 1),
+			wantStatus: http.StatusOK},
+		{name: "route updated", method: http.MethodGet, path: "/admin/routes/r1",
+			wantStatus: http.StatusOK, wantBody: `"path":"/v2"`, eventually: true},
+		{name: "delete route", method: http.MethodDelete, path: "/admin/routes/r1", wantStatus: http.StatusOK},
+		{name: "route gone", method: http.MethodGet, path: "/admin/routes/r1",
+			wantStatus: http.StatusNotFound, eventually: true},
+
+		{name: "delete upstream", method: http.MethodDelete, path: "/admin/upstreams/u1", wantStatus: http.StatusOK},
+		{name: "upstream gone", method: http.MethodGet, path: "/admin/upstreams/u1", wantStatus: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPatch, path: "/admin/routes", wantStatus: http.StatusMethodNotAllowed},
+		{name: "plugin fields", method: http.MethodGet, path: "/admin/plugins",
+			wantStatus: http.StatusOK, wantBody: `"fields":[{"name":"secret","type":"string","required":true`},
+	})
+
+	// 脱敏占位符提交后，存储中仍是原密钥
+	runSteps(t, api, []adminStep{
+		{name: "recreate upstream", method: http.MethodPost, path: "/admin/upstreams", body: testUpstream, wantStatus: http.StatusCreated},
+		{name: "update with placeholder", method: http.MethodPut, path: "/admin/upstreams/u1",
+			body: strings.Replace(testUpstream, "top-secret", "******", 1), wantStatus: http.StatusOK},
+	})
+	kv, err := memory.Get(context.Background(), store.UpstreamPrefix+"u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored config.Upstream
+	if err := json.Unmarshal(kv.Value, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.StickySession.Secret != "top-secret" {
+		t.Fatalf("stored secret = %q, want the original secret", stored.StickySession.Secret)
+	}
+}
+
+func TestAdminRouteSecrets(t *testing.T) {
+	memory := store.NewMemoryStore()
+	api := newTestAPI(t, memory)
+	jwtRoute := strings.Replace(testRoute, `"upstream_id"`, `"plugins": {"jwt": {"secret": "jwt-secret"}}, "upstream_id"`, 1)
+
+	runSteps(t, api, []adminStep{
+		{name: "create route redacts secret", method: http.MethodPost, path: "/admin/routes", body: jwtRoute,
+			wantStatus: http.StatusCreated, wantBody: `"jwt":{"secret":"******"}`, denyBody: "jwt-secret"},
+		{name: "get route redacts secret", method: http.MethodGet, path: "/admin/routes/r1",
+			wantStatus: http.StatusOK, wantBody: `"jwt":{"secret":"******"}`, denyBody: "jwt-secret", eventually: true},
+		{name: "list routes redacts secret", method: http.MethodGet, path: "/admin/routes",
+			wantStatus: http.StatusOK, wantBody: `"total":1`, denyBody: "jwt-secret"},
+		{name: "update route keeps redacted secret", method: http.MethodPut, path: "/admin/routes/r1",
+			body:       strings.Replace(strings.Replace(jwtRoute, "jwt-secret", "******", 1), "/api", "/v2", 1),
+			wantStatus: http.StatusOK, denyBody: "jwt-secret"},
+		{name: "route updated", method: http.MethodGet, path: "/admin/routes/r1",
+			wantStatus: http.StatusOK, wantBody: `"path":"/v2"`, eventually: true},
+		{name: "placeholder without stored secret", method: http.MethodPut, path: "/admin/routes/r2",
+			body:       strings.Replace(strings.Replace(jwtRoute, "jwt-secret", "******", 1), `"r1"`, `"r2"`, 1),
+			wantStatus: http.StatusBadRequest, wantBody: "secret cannot be empty"},
+	})
+
+	// 存储和路由表中仍是原密钥，响应脱敏不影响正在使用的路由
+	kv, err := memory.Get(context.Background(), store.RoutePrefix+"r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(kv.Value), `"secret":"jwt-secret"`) {
+		t.Fatalf("stored route = %s, want the original secret", kv.Value)
+	}
+	live := api.router.GetRoute("r1").Plugins["jwt"].(map[string]any)
+	if live["secret"] != "jwt-secret" {
+		t.Fatalf("live route secret = %v, want the original secret", live["secret"])
+	}
+}
+
+func TestAdminReadOnlyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.json")
+	content := `{"upstreams": [` + testUpstream + `], "routes": [` + testRoute + `]}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fileStore := store.NewFileStore(path, zap.NewNop())
+	if err := fileStore.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer fileStore.Stop()
+
+	runSteps(t, newTestAPI(t, fileStore), []adminStep{
+		{name: "read upstream", method: http.MethodGet, path: "/admin/upstreams/u1", wantStatus: http.StatusOK, denyBody: "top-secret"},
+		{name: "read route", method: http.MethodGet, path: "/admin/routes/r1", wantStatus: http.StatusOK, eventually: true},
+		{name: "create rejected", method: http.MethodPost, path: "/admin/routes", body: testRoute, wantStatus: http.StatusMethodNotAllowed},
+		{name: "delete rejected", method: http.MethodDelete, path: "/admin/upstreams/u1", wantStatus: http.StatusMethodNotAllowed},
+	})
+}
+
+// degraded 模拟配置存储不可用
+type degraded struct{}
+
+func (degraded) Degraded() bool { return true }
+
+func TestAdminDegradedMode(t *testing.T) {
+	memory := store.NewMemoryStore()
+	memory.Put(context.Background(), store.UpstreamPrefix+"u1", []byte(testUpstream))
+	memory.Put(context.Background(), store.RoutePrefix+"r1", []byte(testRoute))
+
+	r := router.NewRouter()
+	watcher := etcdv3.NewConfigWatcher(memory, r, zap.NewNop())
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+	api := NewAdminAPI(memory, r, watcher, degraded{}, zap.NewNop())
+
+	runSteps(t, api, []adminStep{
+		{name: "health", method: http.MethodGet, path: "/admin/health", wantStatus: http.StatusOK, wantBody: "degraded"},
+		{name: "list routes", method: http.MethodGet, path: "/admin/routes", wantStatus: http.StatusOK, wantBody: `"id":"r1"`, eventually: true},
+		{name: "get upstream from snapshot", method: http.MethodGet, path: "/admin/upstreams/u1",
+			wantStatus: http.StatusOK, wantBody: `"secret":"******"`, denyBody: "top-secret"},
+		{name: "list upstreams from snapshot", method: http.MethodGet, path: "/admin/upstreams",
+			wantStatus: http.StatusOK, wantBody: `"total":1`, denyBody: "top-secret"},
+		{name: "runtime targets", method: http.MethodGet, path: "/admin/upstreams/u1/targets", wantStatus: http.StatusOK},
+		{name: "plugins", method: http.MethodGet, path: "/admin/plugins", wantStatus: http.StatusOK},
+		{name: "create rejected", method: http.MethodPost, path: "/admin/routes", body: testRoute, wantStatus: http.StatusServiceUnavailable},
+		{name: "update rejected", method: http.MethodPut, path: "/admin/upstreams/u1", body: testUpstream, wantStatus: http.StatusServiceUnavailable},
+		{name: "delete rejected", method: http.MethodDelete, path: "/admin/routes/r1", wantStatus: http.StatusServiceUnavailable},
+	})
+}
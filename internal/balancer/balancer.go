@@ -4,7 +4,6 @@ import (
 	"errors"
 	"hash/crc32"
 	"math/rand"
-	"sync"
 	"sync/atomic"
 
 	"github.com/RunzhiZhao/long-gate/internal/config"
@@ -15,8 +14,9 @@ var (
 )
 
 // LoadBalancer 负载均衡器接口
+// key 为请求的哈希键（默认客户端 IP，见 HashKey），哈希类策略据此选择节点
 type LoadBalancer interface {
-	Select(clientIP string) (*config.Target, error)
+	Select(key string) (*config.Target, error)
 	UpdateTargets(targets []*config.Target)
 }
 
@@ -33,6 +33,10 @@ func NewLoadBalancer(lbType config.LoadBalanceType, upstream *config.Upstream) L
 		return NewIPHashBalancer(upstream)
 	case config.LoadBalanceRandom:
 		return NewRandomBalancer(upstream)
+	case config.LoadBalanceConsistentHash:
+		return NewConsistentHashBalancer(upstream)
+	case config.LoadBalanceEWMA:
+		return NewEWMABalancer(upstream)
 	default:
 		return NewRoundRobinBalancer(upstream)
 	}
@@ -52,7 +56,7 @@ func NewRoundRobinBalancer(upstream *config.Upstream) *RoundRobinBalancer {
 	}
 }
 
-func (rb *RoundRobinBalancer) Select(clientIP string) (*config.Target, error) {
+func (rb *RoundRobinBalancer) Select(key string) (*config.Target, error) {
 	targets := rb.upstream.GetHealthyTargets()
 	if len(targets) == 0 {
 		return nil, ErrNoHealthyTarget
@@ -66,53 +70,30 @@ func (rb *RoundRobinBalancer) UpdateTargets(targets []*config.Target) {
 	// Round Robin 不需要特殊更新逻辑
 }
 
-// --- Weighted 加权轮询 ---
+// --- Weighted 平滑加权轮询 ---
 
 type WeightedBalancer struct {
 	upstream *config.Upstream
-	current  int
-	mu       sync.Mutex
 }
 
 func NewWeightedBalancer(upstream *config.Upstream) *WeightedBalancer {
 	return &WeightedBalancer{
 		upstream: upstream,
-		current:  0,
 	}
 }
 
-func (wb *WeightedBalancer) Select(clientIP string) (*config.Target, error) {
-	wb.mu.Lock()
-	defer wb.mu.Unlock()
-
+// Select 平滑加权轮询，5:1:1 的节点会交错分配而不是连续打到高权重节点
+func (wb *WeightedBalancer) Select(key string) (*config.Target, error) {
 	targets := wb.upstream.GetHealthyTargets()
 	if len(targets) == 0 {
 		return nil, ErrNoHealthyTarget
 	}
 
-	// 计算总权重
-	totalWeight := 0
-	for _, target := range targets {
-		totalWeight += target.Weight
-	}
-
-	// 加权选择
-	wb.current = (wb.current + 1) % totalWeight
-	sum := 0
-	for _, target := range targets {
-		sum += target.Weight
-		if wb.current < sum {
-			return target, nil
-		}
-	}
-
-	return targets[0], nil
+	return wb.upstream.SmoothWeightedPick(targets), nil
 }
 
 func (wb *WeightedBalancer) UpdateTargets(targets []*config.Target) {
-	wb.mu.Lock()
-	wb.current = 0
-	wb.mu.Unlock()
+	// 当前权重保存在节点上，节点变化时不重置
 }
 
 // --- Least Connection 最少连接 ---
@@ -127,19 +108,19 @@ func NewLeastConnBalancer(upstream *config.Upstream) *LeastConnBalancer {
 	}
 }
 
-func (lb *LeastConnBalancer) Select(clientIP string) (*config.Target, error) {
+func (lb *LeastConnBalancer) Select(key string) (*config.Target, error) {
 	targets := lb.upstream.GetHealthyTargets()
 	if len(targets) == 0 {
 		return nil, ErrNoHealthyTarget
 	}
 
 	// 选择连接数最少的节点
-	minConns := targets[0].ActiveConns
+	minConns := targets[0].ActiveConns()
 	selected := targets[0]
 
 	for _, target := range targets[1:] {
-		if target.ActiveConns < minConns {
-			minConns = target.ActiveConns
+		if conns := target.ActiveConns(); conns < minConns {
+			minConns = conns
 			selected = target
 		}
 	}
@@ -163,14 +144,14 @@ func NewIPHashBalancer(upstream *config.Upstream) *IPHashBalancer {
 	}
 }
 
-func (ih *IPHashBalancer) Select(clientIP string) (*config.Target, error) {
+func (ih *IPHashBalancer) Select(key string) (*config.Target, error) {
 	targets := ih.upstream.GetHealthyTargets()
 	if len(targets) == 0 {
 		return nil, ErrNoHealthyTarget
 	}
 
 	// 使用 CRC32 哈希客户端 IP
-	hash := crc32.ChecksumIEEE([]byte(clientIP))
+	hash := crc32.ChecksumIEEE([]byte(key))
 	idx := int(hash) % len(targets)
 	return targets[idx], nil
 }
@@ -191,7 +172,7 @@ func NewRandomBalancer(upstream *config.Upstream) *RandomBalancer {
 	}
 }
 
-func (rb *RandomBalancer) Select(clientIP string) (*config.Target, error) {
+func (rb *RandomBalancer) Select(key string) (*config.Target, error) {
 	targets := rb.upstream.GetHealthyTargets()
 	if len(targets) == 0 {
 		return nil, ErrNoHealthyTarget
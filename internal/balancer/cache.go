@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"sync"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// Cache 按上游缓存负载均衡器，使轮询游标、哈希环等状态跨请求保留
+type Cache struct {
+	entries map[string]*cacheEntry // upstream_id -> entry
+	mu      sync.RWMutex
+}
+
+type cacheEntry struct {
+	upstream *config.Upstream
+	lbType   config.LoadBalanceType
+	lb       LoadBalancer
+}
+
+// NewCache 创建负载均衡器缓存
+func NewCache() *Cache {
+	return &Cache{
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Get 获取上游对应的负载均衡器，上游配置被替换时重新创建
+func (c *Cache) Get(upstream *config.Upstream) LoadBalancer {
+	c.mu.RLock()
+	entry, ok := c.entries[upstream.ID]
+	c.mu.RUnlock()
+	if ok && entry.upstream == upstream && entry.lbType == upstream.Type {
+		return entry.lb
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok = c.entries[upstream.ID]
+	if ok && entry.upstream == upstream && entry.lbType == upstream.Type {
+		return entry.lb
+	}
+	entry = &cacheEntry{
+		upstream: upstream,
+		lbType:   upstream.Type,
+		lb:       NewLoadBalancer(upstream.Type, upstream),
+	}
+	c.entries[upstream.ID] = entry
+	return entry.lb
+}
+
+// AddUpstream 上游新增或更新时丢弃旧的负载均衡器
+func (c *Cache) AddUpstream(upstream *config.Upstream) {
+	c.RemoveUpstream(upstream.ID)
+}
+
+// RemoveUpstream 移除上游对应的负载均衡器
+func (c *Cache) RemoveUpstream(upstreamID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, upstreamID)
+}
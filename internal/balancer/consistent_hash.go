@@ -0,0 +1,132 @@
+package balancer
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// virtualNodesPerWeight 每单位权重对应的虚拟节点数
+const virtualNodesPerWeight = 40
+
+// --- Consistent Hash 一致性哈希 (Ketama) ---
+
+type ConsistentHashBalancer struct {
+	upstream *config.Upstream
+	mu       sync.RWMutex
+	ring     *hashRing
+}
+
+// hashRing 哈希环（不可变，节点变化时整体重建）
+// 虚拟节点只记录节点地址：服务发现刷新会重建 Target 对象，地址和权重不变时沿用同一个环
+type hashRing struct {
+	signature uint64
+	points    []uint32
+	owners    map[uint32]string
+}
+
+func NewConsistentHashBalancer(upstream *config.Upstream) *ConsistentHashBalancer {
+	return &ConsistentHashBalancer{
+		upstream: upstream,
+	}
+}
+
+func (ch *ConsistentHashBalancer) Select(key string) (*config.Target, error) {
+	targets := ch.upstream.GetHealthyTargets()
+	if len(targets) == 0 {
+		return nil, ErrNoHealthyTarget
+	}
+
+	available := make(map[string]*config.Target, len(targets))
+	for _, target := range targets {
+		available[target.Address] = target
+	}
+
+	// 哈希环包含全部节点，查找时顺时针跳过不可用节点，
+	// 节点上下线只影响其自身负责的那部分键
+	ring := ch.getRing()
+	hash := ketamaHash(key)
+	start := sort.Search(len(ring.points), func(i int) bool {
+		return ring.points[i] >= hash
+	})
+	for i := 0; i < len(ring.points); i++ {
+		if target, ok := available[ring.owners[ring.points[(start+i)%len(ring.points)]]]; ok {
+			return target, nil
+		}
+	}
+
+	return targets[0], nil
+}
+
+func (ch *ConsistentHashBalancer) UpdateTargets(targets []*config.Target) {
+	ch.mu.Lock()
+	ch.ring = nil
+	ch.mu.Unlock()
+}
+
+// getRing 获取哈希环，节点列表或权重变化时重建
+func (ch *ConsistentHashBalancer) getRing() *hashRing {
+	targets := ch.upstream.AllTargets()
+	signature := targetsSignature(targets)
+
+	ch.mu.RLock()
+	ring := ch.ring
+	ch.mu.RUnlock()
+	if ring != nil && ring.signature == signature {
+		return ring
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.ring == nil || ch.ring.signature != signature {
+		ch.ring = buildHashRing(targets, signature)
+	}
+	return ch.ring
+}
+
+// buildHashRing 构建 Ketama 哈希环，每个 MD5 摘要产生 4 个虚拟节点
+func buildHashRing(targets []*config.Target, signature uint64) *hashRing {
+	ring := &hashRing{
+		signature: signature,
+		owners:    make(map[uint32]string),
+	}
+	for _, target := range targets {
+		replicas := target.Weight * virtualNodesPerWeight / 4
+		for i := 0; i < replicas; i++ {
+			digest := md5.Sum([]byte(target.Address + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				point := binary.LittleEndian.Uint32(digest[j*4:])
+				if _, exists := ring.owners[point]; exists {
+					continue
+				}
+				ring.owners[point] = target.Address
+				ring.points = append(ring.points, point)
+			}
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i] < ring.points[j]
+	})
+	return ring
+}
+
+// ketamaHash 计算键在哈希环上的位置
+func ketamaHash(key string) uint32 {
+	digest := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(digest[:4])
+}
+
+// targetsSignature 计算节点列表（地址+权重）的指纹
+func targetsSignature(targets []*config.Target) uint64 {
+	h := fnv.New64a()
+	for _, target := range targets {
+		h.Write([]byte(target.Address))
+		h.Write([]byte{byte(target.Weight)})
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,127 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+func newHashUpstream(t *testing.T, weights ...int) *config.Upstream {
+	t.Helper()
+	upstream := &config.Upstream{ID: "u1", Type: config.LoadBalanceConsistentHash}
+	for i, weight := range weights {
+		upstream.Targets = append(upstream.Targets, &config.Target{
+			Address: fmt.Sprintf("10.0.0.%d:80", i+1),
+			Weight:  weight,
+			Status:  config.TargetStatusHealthy,
+		})
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return upstream
+}
+
+// assign 计算每个键选中的节点地址
+func assign(t *testing.T, lb LoadBalancer, keys int) map[string]string {
+	t.Helper()
+	result := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		target, err := lb.Select(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[key] = target.Address
+	}
+	return result
+}
+
+func TestConsistentHashStable(t *testing.T) {
+	upstream := newHashUpstream(t, 1, 1, 1)
+	first := assign(t, NewConsistentHashBalancer(upstream), 1000)
+	second := assign(t, NewConsistentHashBalancer(upstream), 1000)
+	for key, address := range first {
+		if second[key] != address {
+			t.Fatalf("key %s moved from %s to %s between identical rings", key, address, second[key])
+		}
+	}
+}
+
+func TestConsistentHashTargetDown(t *testing.T) {
+	upstream := newHashUpstream(t, 1, 1, 1, 1)
+	lb := NewConsistentHashBalancer(upstream)
+	before := assign(t, lb, 2000)
+
+	down := "10.0.0.2:80"
+	upstream.UpdateTargetStatus(down, config.TargetStatusUnhealthy)
+	after := assign(t, lb, 2000)
+
+	// 只有原先落在故障节点上的键需要迁移
+	for key, address := range before {
+		switch {
+		case address == down && after[key] == down:
+			t.Fatalf("key %s still routed to unhealthy target", key)
+		case address != down && after[key] != address:
+			t.Fatalf("key %s moved from healthy %s to %s", key, address, after[key])
+		}
+	}
+}
+
+func TestConsistentHashWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+	}{
+		{name: "equal", weights: []int{1, 1, 1}},
+		{name: "weighted", weights: []int{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newHashUpstream(t, tt.weights...)
+			counts := make(map[string]int)
+			const keys = 20000
+			for _, address := range assign(t, NewConsistentHashBalancer(upstream), keys) {
+				counts[address]++
+			}
+
+			total := 0
+			for _, weight := range tt.weights {
+				total += weight
+			}
+			for i, weight := range tt.weights {
+				address := fmt.Sprintf("10.0.0.%d:80", i+1)
+				want := float64(keys) * float64(weight) / float64(total)
+				if got := float64(counts[address]); got < want*0.7 || got > want*1.3 {
+					t.Fatalf("%s got %.0f keys, want about %.0f", address, got, want)
+				}
+			}
+		})
+	}
+}
+
+// 服务发现刷新返回相同地址时会替换 Target 对象，键的分配不应变化
+func TestConsistentHashSetTargets(t *testing.T) {
+	upstream := newHashUpstream(t, 1, 1, 1)
+	lb := NewConsistentHashBalancer(upstream)
+	before := assign(t, lb, 1000)
+
+	refreshed := make([]*config.Target, 0, 3)
+	for _, target := range upstream.AllTargets() {
+		refreshed = append(refreshed, &config.Target{Address: target.Address, Weight: target.Weight, Status: config.TargetStatusHealthy})
+	}
+	upstream.SetTargets(refreshed)
+	after := assign(t, lb, 1000)
+
+	counts := make(map[string]int)
+	for key, address := range before {
+		if after[key] != address {
+			t.Fatalf("key %s moved from %s to %s after refresh with identical targets", key, address, after[key])
+		}
+		counts[address]++
+	}
+	if len(counts) != 3 {
+		t.Fatalf("keys spread over %d targets, want 3", len(counts))
+	}
+}
@@ -0,0 +1,74 @@
+package balancer
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// defaultLatency 所有节点都没有延迟样本时使用的默认延迟
+const defaultLatency = time.Millisecond
+
+// --- EWMA 延迟感知 (Power of Two Choices) ---
+
+type EWMABalancer struct {
+	upstream *config.Upstream
+}
+
+func NewEWMABalancer(upstream *config.Upstream) *EWMABalancer {
+	return &EWMABalancer{
+		upstream: upstream,
+	}
+}
+
+// Select 随机挑选两个节点，选择 延迟EWMA × (在途请求数+1) 较小者
+func (eb *EWMABalancer) Select(key string) (*config.Target, error) {
+	targets := eb.upstream.GetHealthyTargets()
+	if len(targets) == 0 {
+		return nil, ErrNoHealthyTarget
+	}
+	if len(targets) == 1 {
+		return targets[0], nil
+	}
+
+	i := rand.Intn(len(targets))
+	j := rand.Intn(len(targets) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := targets[i], targets[j]
+	if eb.score(b, targets) < eb.score(a, targets) {
+		return b, nil
+	}
+	return a, nil
+}
+
+// score 计算节点负载得分，没有延迟样本的节点使用同伴平均延迟
+func (eb *EWMABalancer) score(target *config.Target, peers []*config.Target) float64 {
+	latency, inflight, ok := eb.upstream.LoadStats(target)
+	if !ok {
+		latency = eb.averageLatency(peers)
+	}
+	return float64(latency) * float64(inflight+1)
+}
+
+func (eb *EWMABalancer) averageLatency(peers []*config.Target) time.Duration {
+	var sum time.Duration
+	count := 0
+	for _, peer := range peers {
+		if latency, _, ok := eb.upstream.LoadStats(peer); ok {
+			sum += latency
+			count++
+		}
+	}
+	if count == 0 {
+		return defaultLatency
+	}
+	return sum / time.Duration(count)
+}
+
+func (eb *EWMABalancer) UpdateTargets(targets []*config.Target) {
+	// 延迟统计保存在节点上，不需要特殊更新逻辑
+}
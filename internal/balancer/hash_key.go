@@ -0,0 +1,55 @@
+package balancer
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/middleware"
+)
+
+// HashKey 根据配置从请求中提取哈希键，取不到时回退为客户端 IP
+func HashKey(ctx *middleware.Context, hashOn *config.HashOn) string {
+	if hashOn != nil {
+		if key := extractHashKey(ctx, hashOn); key != "" {
+			return key
+		}
+	}
+	return ClientIP(ctx)
+}
+
+// ClientIP 获取客户端 IP（不含端口）
+func ClientIP(ctx *middleware.Context) string {
+	if ip, _, err := net.SplitHostPort(ctx.Request.RemoteAddr); err == nil {
+		return ip
+	}
+	return ctx.Request.RemoteAddr
+}
+
+func extractHashKey(ctx *middleware.Context, hashOn *config.HashOn) string {
+	switch hashOn.Source {
+	case config.HashSourceHeader:
+		return ctx.Request.Header.Get(hashOn.Name)
+	case config.HashSourceCookie:
+		if cookie, err := ctx.Request.Cookie(hashOn.Name); err == nil {
+			return cookie.Value
+		}
+	case config.HashSourceQuery:
+		return ctx.Request.URL.Query().Get(hashOn.Name)
+	case config.HashSourcePathParam:
+		return ctx.Params[hashOn.Name]
+	case config.HashSourceJWTClaim:
+		value, ok := ctx.Get("jwt_claims")
+		if !ok {
+			return ""
+		}
+		if claims, ok := value.(jwt.MapClaims); ok {
+			if claim, exists := claims[hashOn.Name]; exists {
+				return fmt.Sprint(claim)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package balancer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// processSecret 未配置密钥时使用的进程级随机签名密钥
+var processSecret = func() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}()
+
+// SelectSticky 会话保持选择
+// 优先选择亲和 Cookie 指定的健康节点；Cookie 缺失、无效或节点不可用时，
+// 由 lb 重新选择。总是返回需要下发的 Cookie，命中时续期使有效期随访问滑动
+func SelectSticky(r *http.Request, upstream *config.Upstream, lb LoadBalancer, key string) (*config.Target, *http.Cookie, error) {
+	cfg := upstream.StickySession
+	secret := stickySecret(cfg)
+
+	if cookie, err := r.Cookie(cfg.CookieName); err == nil {
+		if address, ok := verifyAffinity(cookie.Value, secret, time.Now()); ok {
+			for _, target := range upstream.GetHealthyTargets() {
+				if target.Address == address {
+					return target, newAffinityCookie(cfg, address, secret), nil
+				}
+			}
+		}
+	}
+
+	// 首次请求或绑定节点不可用时透明切换
+	target, err := lb.Select(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return target, newAffinityCookie(cfg, target.Address, secret), nil
+}
+
+func stickySecret(cfg *config.StickySession) []byte {
+	if cfg.Secret != "" {
+		return []byte(cfg.Secret)
+	}
+	return processSecret
+}
+
+// newAffinityCookie 生成亲和 Cookie，值格式: base64(address).expiry.base64(hmac)
+func newAffinityCookie(cfg *config.StickySession, address string, secret []byte) *http.Cookie {
+	expires := time.Now().Add(time.Duration(cfg.TTL) * time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(address)) + "." + strconv.FormatInt(expires.Unix(), 10)
+
+	cookie := &http.Cookie{
+		Name:     cfg.CookieName,
+		Value:    payload + "." + signAffinity(payload, secret),
+		Path:     cfg.Path,
+		Domain:   cfg.Domain,
+		MaxAge:   cfg.TTL,
+		Secure:   cfg.Secure,
+		HttpOnly: cfg.HTTPOnly,
+	}
+	switch strings.ToLower(cfg.SameSite) {
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// verifyAffinity 校验亲和 Cookie 的签名和有效期，返回绑定的节点地址
+func verifyAffinity(value string, secret []byte, now time.Time) (string, bool) {
+	idx := strings.LastIndex(value, ".")
+	if idx < 0 {
+		return "", false
+	}
+	payload, signature := value[:idx], value[idx+1:]
+	if !hmac.Equal([]byte(signature), []byte(signAffinity(payload, secret))) {
+		return "", false
+	}
+
+	encoded, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", false
+	}
+	address, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(address), true
+}
+
+func signAffinity(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
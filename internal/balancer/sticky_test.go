@@ -0,0 +1,71 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+func TestSelectSticky(t *testing.T) {
+	upstream := &config.Upstream{
+		ID:   "u1",
+		Type: config.LoadBalanceRoundRobin,
+		Targets: []*config.Target{
+			{Address: "10.0.0.1:80", Status: config.TargetStatusHealthy},
+			{Address: "10.0.0.2:80", Status: config.TargetStatusHealthy},
+		},
+		StickySession: &config.StickySession{Enabled: true, TTL: 60, Secret: "s3cret"},
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	lb := NewRoundRobinBalancer(upstream)
+	secret := []byte(upstream.StickySession.Secret)
+
+	first, cookie, err := SelectSticky(httptest.NewRequest(http.MethodGet, "/", nil), upstream, lb, "")
+	if err != nil || cookie == nil {
+		t.Fatalf("first request: cookie = %v, err = %v", cookie, err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		down   bool
+		same   bool
+	}{
+		{name: "hit refreshes cookie", cookie: cookie, same: true},
+		{name: "tampered cookie", cookie: &http.Cookie{Name: cookie.Name, Value: cookie.Value + "x"}},
+		{name: "bound target down", cookie: cookie, down: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.down {
+				upstream.UpdateTargetStatus(first.Address, config.TargetStatusUnhealthy)
+				defer upstream.UpdateTargetStatus(first.Address, config.TargetStatusHealthy)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(tt.cookie)
+
+			target, refreshed, err := SelectSticky(r, upstream, lb, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.same && target.Address != first.Address {
+				t.Fatalf("sticky request routed to %s, want %s", target.Address, first.Address)
+			}
+			if tt.down && target.Address == first.Address {
+				t.Fatalf("sticky request routed to unhealthy %s", target.Address)
+			}
+			if refreshed == nil || refreshed.MaxAge != 60 {
+				t.Fatalf("cookie not (re)issued: %v", refreshed)
+			}
+			address, ok := verifyAffinity(refreshed.Value, secret, time.Now())
+			if !ok || address != target.Address {
+				t.Fatalf("issued cookie binds %q (valid %v), want %s", address, ok, target.Address)
+			}
+		})
+	}
+}
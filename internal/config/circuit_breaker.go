@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CircuitBreaker 熔断器配置（作用于每个 Target）
+type CircuitBreaker struct {
+	Enabled             bool    `json:"enabled"`
+	ConsecutiveFailures int     `json:"consecutive_failures"` // 连续失败 N 次后熔断，0 表示不按连续失败熔断
+	ErrorRatio          float64 `json:"error_ratio"`          // 滑动窗口内错误率阈值(0-1)，0 表示不按错误率熔断
+	Window              int     `json:"window"`               // 滑动窗口大小(秒)
+	MinRequests         int     `json:"min_requests"`         // 窗口内最少请求数，不足时不计算错误率
+	OpenTimeout         int     `json:"open_timeout"`         // 熔断持续时间(秒)，之后进入半开状态
+	HalfOpenRequests    int     `json:"half_open_requests"`   // 半开状态下允许的探测请求数
+}
+
+// BreakerState 熔断器状态
+type BreakerState string
+
+const (
+	BreakerStateClosed   BreakerState = "closed"
+	BreakerStateOpen     BreakerState = "open"
+	BreakerStateHalfOpen BreakerState = "half-open"
+)
+
+// validate 校验熔断配置并填充默认值
+func (cb *CircuitBreaker) validate() error {
+	if !cb.Enabled {
+		return nil
+	}
+	if cb.ErrorRatio < 0 || cb.ErrorRatio > 1 {
+		return fmt.Errorf("circuit breaker error_ratio must be between 0 and 1")
+	}
+	if cb.ConsecutiveFailures == 0 && cb.ErrorRatio == 0 {
+		cb.ConsecutiveFailures = 5
+	}
+	if cb.Window == 0 {
+		cb.Window = 10
+	}
+	if cb.MinRequests == 0 {
+		cb.MinRequests = 20
+	}
+	if cb.OpenTimeout == 0 {
+		cb.OpenTimeout = 30
+	}
+	if cb.HalfOpenRequests == 0 {
+		cb.HalfOpenRequests = 1
+	}
+	return nil
+}
+
+// breakerBucket 滑动窗口中一秒的统计
+type breakerBucket struct {
+	second   int64
+	total    int
+	failures int
+}
+
+// breaker 单个节点的熔断器状态（由 Upstream.mu 保护）
+type breaker struct {
+	state               BreakerState
+	consecutiveFailures int
+	buckets             []breakerBucket
+	openedAt            time.Time
+	halfOpenInflight    int
+	halfOpenSuccesses   int
+}
+
+func newBreaker(cfg *CircuitBreaker) *breaker {
+	return &breaker{
+		state:   BreakerStateClosed,
+		buckets: make([]breakerBucket, cfg.Window),
+	}
+}
+
+// clone 复制熔断状态，窗口大小变化时重置滑动窗口
+// 旧版本上的在途探测请求不会在新副本上归还，因此清零半开占用的名额
+func (b *breaker) clone(cfg *CircuitBreaker) *breaker {
+	c := *b
+	c.halfOpenInflight = 0
+	c.buckets = make([]breakerBucket, cfg.Window)
+	if len(b.buckets) == cfg.Window {
+		copy(c.buckets, b.buckets)
+	}
+	return &c
+}
+
+// current 返回当前有效状态（熔断超时后视为半开）
+func (b *breaker) current(cfg *CircuitBreaker, now time.Time) BreakerState {
+	if b.state == BreakerStateOpen && now.Sub(b.openedAt) >= time.Duration(cfg.OpenTimeout)*time.Second {
+		return BreakerStateHalfOpen
+	}
+	return b.state
+}
+
+// allow 判断节点是否可以被选中
+func (b *breaker) allow(cfg *CircuitBreaker, now time.Time) bool {
+	switch b.current(cfg, now) {
+	case BreakerStateOpen:
+		return false
+	case BreakerStateHalfOpen:
+		return b.halfOpenInflight < cfg.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// acquire 节点被选中时调用，半开状态下占用一个探测名额
+// 熔断中或名额已被并发请求占满时返回 false
+func (b *breaker) acquire(cfg *CircuitBreaker, now time.Time) bool {
+	switch b.current(cfg, now) {
+	case BreakerStateOpen:
+		return false
+	case BreakerStateHalfOpen:
+		if b.halfOpenInflight >= cfg.HalfOpenRequests {
+			return false
+		}
+		b.state = BreakerStateHalfOpen
+		b.halfOpenInflight++
+	}
+	return true
+}
+
+// release 归还半开状态下占用的探测名额（请求被取消，没有结果可记录）
+func (b *breaker) release() {
+	if b.state == BreakerStateHalfOpen && b.halfOpenInflight > 0 {
+		b.halfOpenInflight--
+	}
+}
+
+// record 记录一次请求结果，返回状态是否发生变化
+func (b *breaker) record(cfg *CircuitBreaker, success bool, now time.Time) bool {
+	prev := b.state
+
+	switch b.current(cfg, now) {
+	case BreakerStateOpen:
+		// 熔断期间的结果（熔断前发出的请求）不影响状态
+		return false
+
+	case BreakerStateHalfOpen:
+		if b.halfOpenInflight > 0 {
+			b.halfOpenInflight--
+		}
+		if !success {
+			b.trip(now)
+			return true
+		}
+		b.state = BreakerStateHalfOpen
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= cfg.HalfOpenRequests {
+			b.reset()
+		}
+		return b.state != prev
+	}
+
+	// 关闭状态：更新连续失败数和滑动窗口
+	bucket := &b.buckets[now.Unix()%int64(len(b.buckets))]
+	if bucket.second != now.Unix() {
+		*bucket = breakerBucket{second: now.Unix()}
+	}
+	bucket.total++
+	if success {
+		b.consecutiveFailures = 0
+		return false
+	}
+	bucket.failures++
+	b.consecutiveFailures++
+
+	if cfg.ConsecutiveFailures > 0 && b.consecutiveFailures >= cfg.ConsecutiveFailures {
+		b.trip(now)
+		return true
+	}
+	if cfg.ErrorRatio > 0 {
+		total, failures := b.windowStats(now)
+		if total >= cfg.MinRequests && float64(failures)/float64(total) >= cfg.ErrorRatio {
+			b.trip(now)
+			return true
+		}
+	}
+	return false
+}
+
+// windowStats 统计滑动窗口内的请求数和失败数
+func (b *breaker) windowStats(now time.Time) (total, failures int) {
+	oldest := now.Unix() - int64(len(b.buckets))
+	for _, bucket := range b.buckets {
+		if bucket.second > oldest {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
+
+// trip 进入熔断状态
+func (b *breaker) trip(now time.Time) {
+	b.state = BreakerStateOpen
+	b.openedAt = now
+	b.halfOpenInflight = 0
+	b.halfOpenSuccesses = 0
+}
+
+// reset 恢复到关闭状态
+func (b *breaker) reset() {
+	b.state = BreakerStateClosed
+	b.consecutiveFailures = 0
+	b.halfOpenInflight = 0
+	b.halfOpenSuccesses = 0
+	for i := range b.buckets {
+		b.buckets[i] = breakerBucket{}
+	}
+}
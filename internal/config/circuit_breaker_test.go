@@ -0,0 +1,196 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	cfg := &CircuitBreaker{Enabled: true, ConsecutiveFailures: 3, OpenTimeout: 10, HalfOpenRequests: 1}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1700000000, 0)
+
+	// 结果序列：true 表示成功，false 表示失败；步骤之间时间前进 advance
+	type step struct {
+		advance time.Duration
+		acquire bool // 记录前先占用名额（模拟被选中）
+		success bool
+		want    BreakerState
+		changed bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "consecutive failures trip",
+			steps: []step{
+				{success: false, want: BreakerStateClosed},
+				{success: false, want: BreakerStateClosed},
+				{success: false, want: BreakerStateOpen, changed: true},
+			},
+		},
+		{
+			name: "success resets streak",
+			steps: []step{
+				{success: false, want: BreakerStateClosed},
+				{success: false, want: BreakerStateClosed},
+				{success: true, want: BreakerStateClosed},
+				{success: false, want: BreakerStateClosed},
+				{success: false, want: BreakerStateClosed},
+			},
+		},
+		{
+			name: "half-open success closes",
+			steps: []step{
+				{success: false}, {success: false},
+				{success: false, want: BreakerStateOpen, changed: true},
+				{advance: 10 * time.Second, acquire: true, success: true, want: BreakerStateClosed, changed: true},
+			},
+		},
+		{
+			name: "half-open failure reopens",
+			steps: []step{
+				{success: false}, {success: false},
+				{success: false, want: BreakerStateOpen, changed: true},
+				{advance: 10 * time.Second, acquire: true, success: false, want: BreakerStateOpen, changed: true},
+			},
+		},
+		{
+			name: "results while open are ignored",
+			steps: []step{
+				{success: false}, {success: false},
+				{success: false, want: BreakerStateOpen, changed: true},
+				{advance: time.Second, success: true, want: BreakerStateOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker(cfg)
+			now := start
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				if s.acquire {
+					if !b.allow(cfg, now) {
+						t.Fatalf("step %d: breaker should allow a probe", i)
+					}
+					b.acquire(cfg, now)
+				}
+				changed := b.record(cfg, s.success, now)
+				if s.want != "" && b.state != s.want {
+					t.Fatalf("step %d: state = %s, want %s", i, b.state, s.want)
+				}
+				if changed != s.changed {
+					t.Fatalf("step %d: changed = %v, want %v", i, changed, s.changed)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerErrorRatio(t *testing.T) {
+	cfg := &CircuitBreaker{Enabled: true, ErrorRatio: 0.5, MinRequests: 4, Window: 10}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	b := newBreaker(cfg)
+	now := time.Unix(1700000000, 0)
+
+	for i, success := range []bool{true, false, true} {
+		if b.record(cfg, success, now.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("request %d: breaker tripped below min_requests", i)
+		}
+	}
+	if !b.record(cfg, false, now.Add(3*time.Second)) || b.state != BreakerStateOpen {
+		t.Fatalf("breaker should trip at 50%% error ratio, state = %s", b.state)
+	}
+}
+
+func TestBreakerReleaseOnCancel(t *testing.T) {
+	upstream := &Upstream{
+		ID:             "u1",
+		Type:           LoadBalanceRoundRobin,
+		Targets:        []*Target{{Address: "10.0.0.1:80", Status: TargetStatusHealthy}},
+		CircuitBreaker: &CircuitBreaker{Enabled: true, ConsecutiveFailures: 1, OpenTimeout: 1, HalfOpenRequests: 1},
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	address := upstream.Targets[0].Address
+
+	upstream.ReportResult(address, ProxyResult{StatusCode: 502})
+	if got := len(upstream.GetHealthyTargets()); got != 0 {
+		t.Fatalf("open breaker: %d targets available, want 0", got)
+	}
+
+	// 熔断超时后进入半开，唯一的探测请求被客户端取消
+	upstream.Targets[0].breaker.openedAt = time.Now().Add(-2 * time.Second)
+	if got := len(upstream.GetHealthyTargets()); got != 1 {
+		t.Fatalf("half-open breaker: %d targets available, want 1", got)
+	}
+	upstream.IncrementActiveConns(address)
+	if got := len(upstream.GetHealthyTargets()); got != 0 {
+		t.Fatalf("probe in flight: %d targets available, want 0", got)
+	}
+	upstream.ReportResult(address, ProxyResult{Canceled: true})
+	upstream.DecrementActiveConns(address)
+
+	if got := len(upstream.GetHealthyTargets()); got != 1 {
+		t.Fatalf("canceled probe must release the half-open slot: %d targets available, want 1", got)
+	}
+	if state := upstream.TargetStates()[0].Breaker; state != BreakerStateHalfOpen {
+		t.Fatalf("canceled probe changed breaker state to %s", state)
+	}
+}
+
+func TestBreakerHalfOpenSlotsReserved(t *testing.T) {
+	upstream := &Upstream{
+		ID:             "u1",
+		Type:           LoadBalanceRoundRobin,
+		Targets:        []*Target{{Address: "10.0.0.1:80", Status: TargetStatusHealthy}},
+		CircuitBreaker: &CircuitBreaker{Enabled: true, ConsecutiveFailures: 1, OpenTimeout: 1, HalfOpenRequests: 2},
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	address := upstream.Targets[0].Address
+
+	upstream.ReportResult(address, ProxyResult{StatusCode: 502})
+	if upstream.IncrementActiveConns(address) {
+		t.Fatal("open breaker must not hand out a connection")
+	}
+	upstream.Targets[0].breaker.openedAt = time.Now().Add(-2 * time.Second)
+
+	// 所有请求都在占用名额之前看到节点可选
+	const requests = 50
+	for i := 0; i < requests; i++ {
+		if len(upstream.GetHealthyTargets()) != 1 {
+			t.Fatal("half-open target should be selectable")
+		}
+	}
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if upstream.IncrementActiveConns(address) {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := acquired.Load(); got != 2 {
+		t.Fatalf("%d requests acquired half-open slots, want 2", got)
+	}
+	if got := upstream.TargetStates()[0].ActiveConns; got != 2 {
+		t.Fatalf("active conns = %d, want 2", got)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// DiscoveryType 服务发现类型
+type DiscoveryType string
+
+const (
+	DiscoveryDNS  DiscoveryType = "dns"  // 将 Targets 中的域名解析为多个 IP 节点
+	DiscoverySRV  DiscoveryType = "srv"  // 通过 SRV 记录获取节点地址、端口、权重和优先级
+	DiscoveryEtcd DiscoveryType = "etcd" // 服务实例通过 ETCD 租约自注册，Name 为服务名
+	DiscoveryFile DiscoveryType = "file" // 从本地 JSON/YAML 文件读取节点（Prometheus file_sd 格式）
+)
+
+// MetadataHostname DNS 发现的节点记录解析前域名的元数据键
+const MetadataHostname = "hostname"
+
+// Discovery 服务发现配置
+type Discovery struct {
+	Type DiscoveryType `json:"type"`
+	Name string        `json:"name,omitempty"` // SRV 记录名，如 _http._tcp.user.example.com；etcd 类型为服务名
+	Path string        `json:"path,omitempty"` // file 类型的节点文件路径
+	TTL  int           `json:"ttl"`            // 重新解析间隔(秒)，file 类型为文件变更通知之外的兜底重读间隔
+}
+
+// validate 校验服务发现配置并填充默认值
+func (d *Discovery) validate() error {
+	switch d.Type {
+	case DiscoveryDNS:
+	case DiscoverySRV:
+		if d.Name == "" {
+			return fmt.Errorf("srv discovery name cannot be empty")
+		}
+	case DiscoveryEtcd:
+		if d.Name == "" {
+			return fmt.Errorf("etcd discovery service name cannot be empty")
+		}
+	case DiscoveryFile:
+		if d.Path == "" {
+			return fmt.Errorf("file discovery path cannot be empty")
+		}
+	default:
+		return fmt.Errorf("invalid discovery type: %s", d.Type)
+	}
+	if d.TTL == 0 {
+		d.TTL = 30
+	}
+	return nil
+}
+
+// sameSource 两个版本的服务发现配置是否从同一来源获取节点
+func (d *Discovery) sameSource(other *Discovery) bool {
+	return d != nil && other != nil && d.Type == other.Type && d.Name == other.Name && d.Path == other.Path
+}
+
+// discovered 节点列表是否由服务发现动态提供（允许静态 Targets 为空）
+func (u *Upstream) discovered() bool {
+	return u.Discovery != nil && u.Discovery.Type != DiscoveryDNS
+}
+
+// AllTargets 获取当前全部节点（节点列表可能被服务发现替换，需通过该方法读取）
+func (u *Upstream) AllTargets() []*Target {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	targets := make([]*Target, len(u.Targets))
+	copy(targets, u.Targets)
+	return targets
+}
+
+// SetTargets 原子替换节点列表（由服务发现调用）
+// 同地址节点继承运行时状态（见 inheritRuntime），新节点进入慢启动预热，返回新增和移除的节点地址
+func (u *Upstream) SetTargets(targets []*Target) (added, removed []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	previous := make(map[string]*Target, len(u.Targets))
+	for _, target := range u.Targets {
+		previous[target.Address] = target
+	}
+
+	now := time.Now()
+	for _, target := range targets {
+		if target.Status == "" {
+			target.Status = TargetStatusUnknown
+		}
+		if prev, ok := previous[target.Address]; ok {
+			u.inheritRuntime(target, prev)
+			delete(previous, target.Address)
+			continue
+		}
+		target.conns = new(atomic.Int64)
+		if len(u.Targets) > 0 {
+			target.warmupStart = now
+		}
+		added = append(added, target.Address)
+	}
+	for address := range previous {
+		removed = append(removed, address)
+	}
+
+	u.Targets = targets
+	return added, removed
+}
+
+// CarryTargets 沿用旧版本上游由服务发现得到的节点及其运行时状态（上游配置更新时调用），
+// 使新版本在首次解析完成前仍有可用节点。发现来源不同或旧版本没有节点时不沿用，返回是否沿用
+func (u *Upstream) CarryTargets(old *Upstream) bool {
+	if !u.Discovery.sameSource(old.Discovery) {
+		return false
+	}
+
+	old.mu.RLock()
+	defer old.mu.RUnlock()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(old.Targets) == 0 {
+		return false
+	}
+	targets := make([]*Target, 0, len(old.Targets))
+	for _, prev := range old.Targets {
+		target := &Target{
+			Address:  prev.Address,
+			Weight:   prev.Weight,
+			Priority: prev.Priority,
+			Status:   prev.Status,
+			Metadata: prev.Metadata,
+		}
+		u.inheritRuntime(target, prev)
+		targets = append(targets, target)
+	}
+	u.Targets = targets
+	return true
+}
+
+// Host 转发请求和 HTTP 探测使用的默认 Host
+// DNS 解析得到的节点使用解析前的域名加端口，与直接配置域名节点时一致，其他节点使用节点地址
+func (t *Target) Host() string {
+	hostname := t.Metadata[MetadataHostname]
+	if hostname == "" {
+		return t.Address
+	}
+	_, port, err := net.SplitHostPort(t.Address)
+	if err != nil {
+		return t.Address
+	}
+	return net.JoinHostPort(hostname, port)
+}
@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestTargetHost(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		want   string
+	}{
+		{name: "static", target: Target{Address: "user.internal:8080"}, want: "user.internal:8080"},
+		{name: "dns resolved", target: Target{Address: "10.0.0.1:8080", Metadata: map[string]string{MetadataHostname: "user.internal"}}, want: "user.internal:8080"},
+		{name: "dns ipv6", target: Target{Address: "[fd00::1]:8080", Metadata: map[string]string{MetadataHostname: "user.internal"}}, want: "user.internal:8080"},
+		{name: "ip template", target: Target{Address: "10.0.0.1:8080", Metadata: map[string]string{MetadataHostname: "10.0.0.1"}}, want: "10.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.Host(); got != tt.want {
+				t.Fatalf("Host() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
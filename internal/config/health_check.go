@@ -0,0 +1,224 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HealthCheckType 主动健康检查类型
+type HealthCheckType string
+
+const (
+	HealthCheckHTTP HealthCheckType = "http"
+	HealthCheckTCP  HealthCheckType = "tcp"
+	HealthCheckGRPC HealthCheckType = "grpc" // grpc.health.v1 标准健康检查协议
+)
+
+// HealthCheck 健康检查配置
+type HealthCheck struct {
+	Enabled            bool            `json:"enabled"`
+	Type               HealthCheckType `json:"type"`                // http/tcp/grpc，默认 http
+	Path               string          `json:"path"`                // HTTP 检查路径
+	Interval           int             `json:"interval"`            // 检查间隔(秒)
+	Timeout            int             `json:"timeout"`             // 超时时间(秒)
+	HealthyThreshold   int             `json:"healthy_threshold"`   // 健康阈值
+	UnhealthyThreshold int             `json:"unhealthy_threshold"` // 不健康阈值
+
+	// HTTP 检查
+	Method           string            `json:"method,omitempty"`            // 默认 GET
+	Host             string            `json:"host,omitempty"`              // 请求 Host，默认节点地址（DNS 节点为解析前的域名）
+	Headers          map[string]string `json:"headers,omitempty"`           // 附加请求头
+	ExpectedStatuses []string          `json:"expected_statuses,omitempty"` // 视为健康的状态码，如 "200-299"、"404"，默认 200-399
+	BodyContains     string            `json:"body_contains,omitempty"`     // 响应体需包含的子串
+	BodyRegex        string            `json:"body_regex,omitempty"`        // 响应体需匹配的正则
+
+	// TCP 检查：连接建立后发送 Send，并要求在超时前收到包含 Expect 的数据
+	Send   string `json:"send,omitempty"`
+	Expect string `json:"expect,omitempty"`
+
+	// gRPC 检查的服务名，为空时检查整个服务端
+	Service string `json:"service,omitempty"`
+
+	// 探测使用 TLS（HTTP 检查使用 https）
+	TLS *HealthCheckTLS `json:"tls,omitempty"`
+
+	// 被动健康检查（基于真实流量结果）
+	Passive *PassiveHealthCheck `json:"passive,omitempty"`
+
+	statusRanges []statusRange
+	bodyRegex    *regexp.Regexp
+}
+
+// HealthCheckTLS 健康检查 TLS 配置
+type HealthCheckTLS struct {
+	Enabled            bool   `json:"enabled"`
+	ServerName         string `json:"server_name,omitempty"` // SNI 及证书校验使用的域名
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	CAFile             string `json:"ca_file,omitempty"`   // 校验节点证书的 CA，默认系统根证书
+	CertFile           string `json:"cert_file,omitempty"` // 客户端证书（mTLS）
+	KeyFile            string `json:"key_file,omitempty"`
+
+	config *tls.Config
+}
+
+// PassiveHealthCheck 被动健康检查配置
+type PassiveHealthCheck struct {
+	Enabled           bool  `json:"enabled"`
+	UnhealthyStatuses []int `json:"unhealthy_statuses"` // 视为失败的响应状态码，默认 500/502/503/504
+	RecoveryTime      int   `json:"recovery_time"`      // 未启用主动检查时，被摘除节点在 N 秒后重新放行(秒)
+}
+
+// statusRange 状态码闭区间
+type statusRange struct {
+	from, to int
+}
+
+// validate 校验主动健康检查配置并填充默认值，编译状态码范围、正则和 TLS 配置
+func (hc *HealthCheck) validate() error {
+	if !hc.Enabled {
+		return nil
+	}
+
+	switch hc.Type {
+	case "":
+		hc.Type = HealthCheckHTTP
+	case HealthCheckHTTP, HealthCheckTCP, HealthCheckGRPC:
+	default:
+		return fmt.Errorf("invalid health check type: %s", hc.Type)
+	}
+	if hc.Interval == 0 {
+		hc.Interval = 10
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = 5
+	}
+	if hc.HealthyThreshold == 0 {
+		hc.HealthyThreshold = 2
+	}
+	if hc.UnhealthyThreshold == 0 {
+		hc.UnhealthyThreshold = 3
+	}
+
+	if hc.Type == HealthCheckHTTP {
+		if hc.Method == "" {
+			hc.Method = http.MethodGet
+		}
+		hc.Method = strings.ToUpper(hc.Method)
+		if hc.Path == "" {
+			hc.Path = "/"
+		}
+
+		hc.statusRanges = hc.statusRanges[:0]
+		for _, expected := range hc.ExpectedStatuses {
+			r, err := parseStatusRange(expected)
+			if err != nil {
+				return err
+			}
+			hc.statusRanges = append(hc.statusRanges, r)
+		}
+		if len(hc.statusRanges) == 0 {
+			hc.statusRanges = append(hc.statusRanges, statusRange{from: 200, to: 399})
+		}
+
+		if hc.BodyRegex != "" {
+			regex, err := regexp.Compile(hc.BodyRegex)
+			if err != nil {
+				return fmt.Errorf("invalid health check body_regex: %w", err)
+			}
+			hc.bodyRegex = regex
+		}
+	}
+
+	if hc.TLS != nil {
+		if err := hc.TLS.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseStatusRange 解析 "200" 或 "200-299" 格式的状态码范围
+func parseStatusRange(s string) (statusRange, error) {
+	from, to, found := strings.Cut(strings.TrimSpace(s), "-")
+	if !found {
+		to = from
+	}
+	lo, err1 := strconv.Atoi(strings.TrimSpace(from))
+	hi, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if err1 != nil || err2 != nil || lo < 100 || hi > 599 || lo > hi {
+		return statusRange{}, fmt.Errorf("invalid health check expected status: %s", s)
+	}
+	return statusRange{from: lo, to: hi}, nil
+}
+
+// ExpectStatus 状态码是否视为健康
+func (hc *HealthCheck) ExpectStatus(code int) bool {
+	for _, r := range hc.statusRanges {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// ChecksBody 是否需要检查响应体
+func (hc *HealthCheck) ChecksBody() bool {
+	return hc.BodyContains != "" || hc.bodyRegex != nil
+}
+
+// MatchBody 响应体是否满足子串和正则条件
+func (hc *HealthCheck) MatchBody(body []byte) bool {
+	if hc.BodyContains != "" && !strings.Contains(string(body), hc.BodyContains) {
+		return false
+	}
+	if hc.bodyRegex != nil && !hc.bodyRegex.Match(body) {
+		return false
+	}
+	return true
+}
+
+// TLSConfig 探测使用的 TLS 配置，未启用 TLS 时返回 nil
+func (hc *HealthCheck) TLSConfig() *tls.Config {
+	if hc.TLS == nil || !hc.TLS.Enabled {
+		return nil
+	}
+	return hc.TLS.config.Clone()
+}
+
+// validate 加载证书并构建 TLS 配置
+func (t *HealthCheckTLS) validate() error {
+	if !t.Enabled {
+		return nil
+	}
+
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return fmt.Errorf("read health check ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in health check ca_file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load health check client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	t.config = cfg
+	return nil
+}
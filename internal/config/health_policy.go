@@ -0,0 +1,57 @@
+package config
+
+import "fmt"
+
+// UnknownTargetPolicy 未知状态节点的处理策略
+type UnknownTargetPolicy string
+
+const (
+	UnknownTargetEligible   UnknownTargetPolicy = "eligible"   // 未知状态节点可参与负载均衡
+	UnknownTargetIneligible UnknownTargetPolicy = "ineligible" // 未知状态节点需等待健康检查确认
+)
+
+// HealthPolicy 节点选择策略
+type HealthPolicy struct {
+	// 为空时启用主动检查的上游等待健康检查确认，否则视为可用
+	UnknownTargets UnknownTargetPolicy `json:"unknown_targets,omitempty"`
+	// 可用节点数占比低于该值(%)时进入恐慌模式，忽略健康状态选择节点（熔断和异常摘除仍然生效），0 表示不启用
+	PanicThreshold int `json:"panic_threshold"`
+}
+
+// validate 校验节点选择策略并填充默认值
+func (hp *HealthPolicy) validate() error {
+	switch hp.UnknownTargets {
+	case "", UnknownTargetEligible, UnknownTargetIneligible:
+	default:
+		return fmt.Errorf("invalid health policy unknown_targets: %s", hp.UnknownTargets)
+	}
+	if hp.PanicThreshold < 0 || hp.PanicThreshold > 100 {
+		return fmt.Errorf("health policy panic_threshold must be between 0 and 100")
+	}
+	return nil
+}
+
+// unknownEligible 未知状态节点是否可参与负载均衡
+// 默认只有未启用主动检查的上游将未知状态节点视为可用（没有探测会确认其状态），
+// 启用主动检查时等待首次探测确认，策略显式配置时以配置为准
+func (u *Upstream) unknownEligible() bool {
+	if u.HealthPolicy != nil && u.HealthPolicy.UnknownTargets != "" {
+		return u.HealthPolicy.UnknownTargets == UnknownTargetEligible
+	}
+	return !u.activeEnabled()
+}
+
+// inPanic 可用节点占比是否低于恐慌阈值（调用方需持有锁）
+func (u *Upstream) inPanic(available int) bool {
+	if u.HealthPolicy == nil || u.HealthPolicy.PanicThreshold == 0 || len(u.Targets) == 0 {
+		return false
+	}
+	return available*100 < len(u.Targets)*u.HealthPolicy.PanicThreshold
+}
+
+// InPanic 上游当前是否处于恐慌模式
+func (u *Upstream) InPanic() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.inPanic(len(u.availableTargets()))
+}
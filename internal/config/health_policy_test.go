@@ -0,0 +1,106 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func availableAddresses(u *Upstream) string {
+	addresses := make([]string, 0)
+	for _, target := range u.GetHealthyTargets() {
+		addresses = append(addresses, target.Address)
+	}
+	sort.Strings(addresses)
+	return strings.Join(addresses, ",")
+}
+
+func TestUnknownTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		check  *HealthCheck
+		policy *HealthPolicy
+		want   string
+	}{
+		{name: "no health check", want: "a,b"},
+		{name: "passive only", check: &HealthCheck{Passive: &PassiveHealthCheck{Enabled: true}}, want: "a,b"},
+		{name: "active waits for probe", check: &HealthCheck{Enabled: true}, want: ""},
+		{name: "active with empty policy", check: &HealthCheck{Enabled: true}, policy: &HealthPolicy{}, want: ""},
+		{name: "active opted in", check: &HealthCheck{Enabled: true}, policy: &HealthPolicy{UnknownTargets: UnknownTargetEligible}, want: "a,b"},
+		{name: "passive opted out", check: &HealthCheck{Passive: &PassiveHealthCheck{Enabled: true}}, policy: &HealthPolicy{UnknownTargets: UnknownTargetIneligible}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &Upstream{
+				ID:           "u1",
+				Type:         LoadBalanceRoundRobin,
+				Targets:      []*Target{{Address: "a"}, {Address: "b"}},
+				HealthCheck:  tt.check,
+				HealthPolicy: tt.policy,
+			}
+			if err := upstream.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := availableAddresses(upstream); got != tt.want {
+				t.Fatalf("available = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPanicMode(t *testing.T) {
+	newUpstream := func(t *testing.T) *Upstream {
+		upstream := &Upstream{
+			ID:   "u1",
+			Type: LoadBalanceRoundRobin,
+			Targets: []*Target{
+				{Address: "a", Status: TargetStatusUnhealthy},
+				{Address: "b", Status: TargetStatusUnhealthy},
+				{Address: "c", Status: TargetStatusHealthy},
+				{Address: "d", Status: TargetStatusUnhealthy},
+				{Address: "backup", Priority: 1, Status: TargetStatusUnhealthy},
+			},
+			HealthCheck:      &HealthCheck{Enabled: true},
+			HealthPolicy:     &HealthPolicy{PanicThreshold: 50},
+			CircuitBreaker:   &CircuitBreaker{Enabled: true, ConsecutiveFailures: 1},
+			OutlierDetection: &OutlierDetection{Enabled: true, MaxEjectionPercent: 100},
+		}
+		if err := upstream.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return upstream
+	}
+
+	tests := []struct {
+		name  string
+		setup func(u *Upstream)
+		panic bool
+		want  string
+	}{
+		{name: "ignores health within highest priority", panic: true, want: "a,b,c,d"},
+		{name: "excludes open breaker", setup: func(u *Upstream) {
+			u.ReportResult("a", ProxyResult{StatusCode: 502})
+		}, panic: true, want: "b,c,d"},
+		{name: "excludes ejected target", setup: func(u *Upstream) {
+			u.EjectTarget("b", EjectionReasonSuccessRate)
+		}, panic: true, want: "a,c,d"},
+		{name: "above threshold", setup: func(u *Upstream) {
+			u.UpdateTargetStatus("a", TargetStatusHealthy)
+			u.UpdateTargetStatus("b", TargetStatusHealthy)
+		}, want: "a,b,c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newUpstream(t)
+			if tt.setup != nil {
+				tt.setup(upstream)
+			}
+			if got := upstream.InPanic(); got != tt.panic {
+				t.Fatalf("in panic = %v, want %v", got, tt.panic)
+			}
+			if got := availableAddresses(upstream); got != tt.want {
+				t.Fatalf("available = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
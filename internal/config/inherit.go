@@ -0,0 +1,56 @@
+package config
+
+import "sync/atomic"
+
+// InheritState 从旧版本上游继承同地址节点的运行时状态（见 inheritRuntime），
+// 使配置更新不打乱流量分布，也不重置熔断、摘除和健康检查进度
+func (u *Upstream) InheritState(old *Upstream) {
+	old.mu.RLock()
+	defer old.mu.RUnlock()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	previous := make(map[string]*Target, len(old.Targets))
+	for _, target := range old.Targets {
+		previous[target.Address] = target
+	}
+	for _, target := range u.Targets {
+		if prev, ok := previous[target.Address]; ok {
+			u.inheritRuntime(target, prev)
+		}
+	}
+}
+
+// inheritRuntime 继承同一节点的运行时状态（调用方需持有 u 的写锁和 prev 所属上游的读锁）
+// 负载均衡状态（平滑加权当前权重、延迟 EWMA、慢启动进度）和在途请求计数总是继承；
+// 熔断和异常摘除状态在启用对应功能时复制一份，新旧版本互不影响；
+// 健康状态只在启用健康检查时继承，否则保留新节点自身的状态
+func (u *Upstream) inheritRuntime(target, prev *Target) {
+	target.currentWeight = prev.currentWeight
+	target.latencyEWMA = prev.latencyEWMA
+	target.latencyAt = prev.latencyAt
+	target.warmupStart = prev.warmupStart
+
+	target.conns = prev.conns
+	if target.conns == nil {
+		target.conns = new(atomic.Int64)
+	}
+
+	if u.breakerEnabled() && prev.breaker != nil {
+		target.breaker = prev.breaker.clone(u.CircuitBreaker)
+	}
+	if u.outlierEnabled() && prev.outlier != nil {
+		target.outlier = prev.outlier.clone()
+	}
+
+	if u.activeEnabled() || u.passiveEnabled() {
+		target.Status = prev.Status
+		target.FailCount = prev.FailCount
+		target.successCount = prev.successCount
+		target.probes = append([]ProbeRecord(nil), prev.probes...)
+		target.LastCheckAt = prev.LastCheckAt
+		target.LastFailAt = prev.LastFailAt
+		target.passiveFails = prev.passiveFails
+		target.passiveEjected = prev.passiveEjected
+	}
+}
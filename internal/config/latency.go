@@ -0,0 +1,50 @@
+package config
+
+import (
+	"math"
+	"time"
+)
+
+// latencyDecay EWMA 的衰减时间常数，越久之前的样本权重越低
+const latencyDecay = 10 * time.Second
+
+// latencyPenalty 失败请求计入的延迟下限（未配置上游超时时使用），
+// 避免快速失败的节点因延迟低而吸引更多流量
+const latencyPenalty = 5 * time.Second
+
+// latencyTracked 是否需要统计节点延迟
+func (u *Upstream) latencyTracked() bool {
+	return u.Type == LoadBalanceEWMA
+}
+
+// latencySample 计算请求结果对应的延迟样本，连接错误和 5xx 按不低于超时时间计入
+func (u *Upstream) latencySample(result ProxyResult) time.Duration {
+	if result.StatusCode != 0 && result.StatusCode < 500 {
+		return result.Latency
+	}
+	penalty := latencyPenalty
+	if u.Timeout > 0 {
+		penalty = time.Duration(u.Timeout) * time.Second
+	}
+	return max(result.Latency, penalty)
+}
+
+// recordLatency 更新节点延迟的指数加权移动平均（调用方需持有锁）
+// 按样本间隔做时间衰减，长时间无请求的节点历史延迟会快速失效
+func (u *Upstream) recordLatency(target *Target, latency time.Duration, now time.Time) {
+	if target.latencyAt.IsZero() {
+		target.latencyEWMA = float64(latency)
+		target.latencyAt = now
+		return
+	}
+	weight := math.Exp(-float64(now.Sub(target.latencyAt)) / float64(latencyDecay))
+	target.latencyEWMA = target.latencyEWMA*weight + float64(latency)*(1-weight)
+	target.latencyAt = now
+}
+
+// LoadStats 获取节点的延迟 EWMA 和在途请求数，没有延迟样本时 ok 为 false
+func (u *Upstream) LoadStats(target *Target) (ewma time.Duration, inflight int, ok bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return time.Duration(target.latencyEWMA), target.ActiveConns(), !target.latencyAt.IsZero()
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyPenalizesFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout int
+		result  ProxyResult
+		want    time.Duration
+	}{
+		{name: "success", result: ProxyResult{StatusCode: 200, Latency: 20 * time.Millisecond}, want: 20 * time.Millisecond},
+		{name: "4xx counts as success", result: ProxyResult{StatusCode: 404, Latency: time.Millisecond}, want: time.Millisecond},
+		{name: "connection refused", result: ProxyResult{Latency: time.Millisecond}, want: latencyPenalty},
+		{name: "5xx uses upstream timeout", timeout: 2, result: ProxyResult{StatusCode: 503, Latency: time.Millisecond}, want: 2 * time.Second},
+		{name: "slow failure keeps its latency", timeout: 1, result: ProxyResult{StatusCode: 502, Latency: 3 * time.Second}, want: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &Upstream{
+				ID:      "u1",
+				Type:    LoadBalanceEWMA,
+				Timeout: tt.timeout,
+				Targets: []*Target{{Address: "10.0.0.1:80", Status: TargetStatusHealthy}},
+			}
+			if err := upstream.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			upstream.ReportResult("10.0.0.1:80", tt.result)
+
+			ewma, _, ok := upstream.LoadStats(upstream.Targets[0])
+			if !ok || ewma != tt.want {
+				t.Fatalf("ewma = %s (ok %v), want %s", ewma, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Locality 地域/可用区
+type Locality struct {
+	Region string `json:"region,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+}
+
+// localLocality 网关自身所在的地域/可用区（启动时设置）
+var localLocality atomic.Pointer[Locality]
+
+// SetLocalLocality 设置网关自身所在的地域/可用区
+func SetLocalLocality(l Locality) {
+	localLocality.Store(&l)
+}
+
+// LocalLocality 获取网关自身所在的地域/可用区
+func LocalLocality() Locality {
+	if l := localLocality.Load(); l != nil {
+		return *l
+	}
+	return Locality{}
+}
+
+// LocalityAware 就近路由配置
+// 优先选择与网关同可用区的节点，本地健康容量不足时依次溢出到同地域、其他地域
+type LocalityAware struct {
+	Enabled           bool   `json:"enabled"`
+	ZoneKey           string `json:"zone_key"`            // Target.Metadata 中可用区的键，默认 zone
+	RegionKey         string `json:"region_key"`          // Target.Metadata 中地域的键，默认 region
+	MinHealthyPercent int    `json:"min_healthy_percent"` // 本地健康权重占比低于该值时溢出，默认 70
+}
+
+// validate 校验就近路由配置并填充默认值
+func (la *LocalityAware) validate() error {
+	if !la.Enabled {
+		return nil
+	}
+	if la.MinHealthyPercent < 0 || la.MinHealthyPercent > 100 {
+		return fmt.Errorf("locality min_healthy_percent must be between 0 and 100")
+	}
+	if la.ZoneKey == "" {
+		la.ZoneKey = "zone"
+	}
+	if la.RegionKey == "" {
+		la.RegionKey = "region"
+	}
+	if la.MinHealthyPercent == 0 {
+		la.MinHealthyPercent = 70
+	}
+	return nil
+}
+
+// localityTier 节点相对网关的距离：0 同可用区，1 同地域，2 其他
+func (la *LocalityAware) localityTier(target *Target, local Locality) int {
+	region := target.Metadata[la.RegionKey]
+	zone := target.Metadata[la.ZoneKey]
+	sameRegion := local.Region == "" || region == "" || region == local.Region
+
+	if local.Zone != "" && zone == local.Zone && sameRegion {
+		return 0
+	}
+	if local.Region != "" && region == local.Region {
+		return 1
+	}
+	return 2
+}
+
+// preferLocal 按就近原则过滤可用节点（调用方需持有锁）
+// 逐级扩大范围，直到范围内健康权重占配置权重的比例达到 MinHealthyPercent
+func (u *Upstream) preferLocal(targets, available []*Target) []*Target {
+	if u.LocalityAware == nil || !u.LocalityAware.Enabled || len(available) == 0 {
+		return available
+	}
+	local := LocalLocality()
+	if local.Zone == "" && local.Region == "" {
+		return available
+	}
+
+	la := u.LocalityAware
+	isAvailable := make(map[*Target]bool, len(available))
+	for _, target := range available {
+		isAvailable[target] = true
+	}
+
+	for tier := 0; tier < 2; tier++ {
+		total, healthy := 0, 0
+		for _, target := range targets {
+			if la.localityTier(target, local) > tier {
+				continue
+			}
+			total += target.Weight
+			if isAvailable[target] {
+				healthy += target.Weight
+			}
+		}
+		if total == 0 || healthy*100 < total*la.MinHealthyPercent {
+			continue
+		}
+
+		preferred := make([]*Target, 0, len(available))
+		for _, target := range available {
+			if la.localityTier(target, local) <= tier {
+				preferred = append(preferred, target)
+			}
+		}
+		return preferred
+	}
+	return available
+}
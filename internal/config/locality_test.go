@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestPreferLocal(t *testing.T) {
+	tests := []struct {
+		name  string
+		local Locality
+		down  []string
+		want  string
+	}{
+		{name: "local zone healthy", local: Locality{Region: "r1", Zone: "za"}, want: "za1,za2"},
+		{name: "zone at threshold", local: Locality{Region: "r1", Zone: "za"}, down: []string{"za1"}, want: "za2"},
+		{name: "spill to region", local: Locality{Region: "r1", Zone: "za"}, down: []string{"za1", "za2"}, want: "zb1,zb2"},
+		{name: "spill everywhere", local: Locality{Region: "r1", Zone: "za"}, down: []string{"za1", "za2", "zb1"}, want: "r2,zb2"},
+		{name: "region only", local: Locality{Region: "r1"}, want: "za1,za2,zb1,zb2"},
+		{name: "locality unknown", want: "r2,za1,za2,zb1,zb2"},
+	}
+
+	t.Cleanup(func() { SetLocalLocality(Locality{}) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetLocalLocality(tt.local)
+			upstream := &Upstream{
+				ID:   "u1",
+				Type: LoadBalanceRoundRobin,
+				Targets: []*Target{
+					{Address: "za1", Metadata: map[string]string{"region": "r1", "zone": "za"}},
+					{Address: "za2", Metadata: map[string]string{"region": "r1", "zone": "za"}},
+					{Address: "zb1", Metadata: map[string]string{"region": "r1", "zone": "zb"}},
+					{Address: "zb2", Metadata: map[string]string{"region": "r1", "zone": "zb"}},
+					{Address: "r2", Metadata: map[string]string{"region": "r2", "zone": "zc"}},
+				},
+				LocalityAware: &LocalityAware{Enabled: true, MinHealthyPercent: 50},
+			}
+			if err := upstream.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			for _, address := range tt.down {
+				upstream.UpdateTargetStatus(address, TargetStatusUnhealthy)
+			}
+			if got := availableAddresses(upstream); got != tt.want {
+				t.Fatalf("available = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
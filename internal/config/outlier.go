@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// OutlierDetection 异常节点检测配置
+type OutlierDetection struct {
+	Enabled                bool    `json:"enabled"`
+	Interval               int     `json:"interval"`                  // 检测周期(秒)
+	BaseEjectionTime       int     `json:"base_ejection_time"`        // 基础摘除时间(秒)，第 N 次摘除持续 N 倍
+	MaxEjectionPercent     int     `json:"max_ejection_percent"`      // 最大摘除比例(%)
+	MinRequests            int     `json:"min_requests"`              // 周期内最少请求数，不足的节点不参与统计
+	MinHosts               int     `json:"min_hosts"`                 // 参与统计的最少节点数
+	SuccessRateStdevFactor float64 `json:"success_rate_stdev_factor"` // 成功率低于 均值-系数*标准差 时摘除
+	LatencyFactor          float64 `json:"latency_factor"`            // 平均延迟超过同伴中位数的倍数时摘除，0 表示不检测延迟
+}
+
+// EjectionReason 摘除原因
+type EjectionReason string
+
+const (
+	EjectionReasonSuccessRate EjectionReason = "success_rate"
+	EjectionReasonLatency     EjectionReason = "latency"
+)
+
+// OutlierSample 一个检测周期内节点的请求统计
+type OutlierSample struct {
+	Address  string
+	Requests int
+	Failures int
+	Latency  time.Duration // 平均延迟
+}
+
+// Ejection 节点摘除记录
+type Ejection struct {
+	Address       string         `json:"address"`
+	Reason        EjectionReason `json:"reason"`
+	EjectedAt     time.Time      `json:"ejected_at"`
+	EjectedUntil  time.Time      `json:"ejected_until"`
+	EjectionCount int            `json:"ejection_count"`
+}
+
+// outlierState 节点异常检测状态（由 Upstream.mu 保护）
+type outlierState struct {
+	requests      int
+	failures      int
+	latencySum    time.Duration
+	ejection      *Ejection
+	ejectionCount int
+}
+
+// clone 复制异常检测状态
+func (s *outlierState) clone() *outlierState {
+	c := *s
+	if s.ejection != nil {
+		ejection := *s.ejection
+		c.ejection = &ejection
+	}
+	return &c
+}
+
+// validate 校验异常检测配置并填充默认值
+func (od *OutlierDetection) validate() error {
+	if !od.Enabled {
+		return nil
+	}
+	if od.MaxEjectionPercent < 0 || od.MaxEjectionPercent > 100 {
+		return fmt.Errorf("outlier detection max_ejection_percent must be between 0 and 100")
+	}
+	if od.Interval == 0 {
+		od.Interval = 10
+	}
+	if od.BaseEjectionTime == 0 {
+		od.BaseEjectionTime = 30
+	}
+	if od.MaxEjectionPercent == 0 {
+		od.MaxEjectionPercent = 10
+	}
+	if od.MinRequests == 0 {
+		od.MinRequests = 10
+	}
+	if od.MinHosts == 0 {
+		od.MinHosts = 3
+	}
+	if od.SuccessRateStdevFactor == 0 {
+		od.SuccessRateStdevFactor = 1.9
+	}
+	return nil
+}
+
+// outlierEnabled 是否启用异常检测
+func (u *Upstream) outlierEnabled() bool {
+	return u.OutlierDetection != nil && u.OutlierDetection.Enabled
+}
+
+// ejected 节点是否处于摘除中（调用方需持有锁）
+func (t *Target) ejected(now time.Time) bool {
+	return t.outlier != nil && t.outlier.ejection != nil && now.Before(t.outlier.ejection.EjectedUntil)
+}
+
+// recordOutlier 累计异常检测统计（调用方需持有锁）
+func (u *Upstream) recordOutlier(target *Target, result ProxyResult) {
+	if target.outlier == nil {
+		target.outlier = &outlierState{}
+	}
+	target.outlier.requests++
+	target.outlier.latencySum += result.Latency
+	if result.StatusCode == 0 || result.StatusCode >= 500 {
+		target.outlier.failures++
+	}
+}
+
+// DrainOutlierSamples 取出并清空本周期内未被摘除节点的请求统计
+func (u *Upstream) DrainOutlierSamples() []OutlierSample {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	samples := make([]OutlierSample, 0, len(u.Targets))
+	for _, target := range u.Targets {
+		state := target.outlier
+		if state == nil || target.ejected(now) {
+			continue
+		}
+		if state.requests > 0 {
+			samples = append(samples, OutlierSample{
+				Address:  target.Address,
+				Requests: state.requests,
+				Failures: state.failures,
+				Latency:  state.latencySum / time.Duration(state.requests),
+			})
+		}
+		state.requests, state.failures, state.latencySum = 0, 0, 0
+	}
+	return samples
+}
+
+// EjectTarget 摘除节点，摘除时间随摘除次数递增
+// 若摘除后超过最大摘除比例则放弃，返回摘除记录和是否成功
+func (u *Upstream) EjectTarget(address string, reason EjectionReason) (*Ejection, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.outlierEnabled() {
+		return nil, false
+	}
+
+	now := time.Now()
+	var target *Target
+	ejected := 0
+	for _, t := range u.Targets {
+		if t.Address == address {
+			target = t
+		}
+		if t.ejected(now) {
+			ejected++
+		}
+	}
+	if target == nil || target.ejected(now) {
+		return nil, false
+	}
+
+	// 最大摘除比例保护：至少允许摘除一个节点，但永远不摘除整个节点池
+	maxEjected := len(u.Targets) * u.OutlierDetection.MaxEjectionPercent / 100
+	if maxEjected < 1 {
+		maxEjected = 1
+	}
+	if ejected+1 > maxEjected || ejected+1 >= len(u.Targets) {
+		return nil, false
+	}
+
+	if target.outlier == nil {
+		target.outlier = &outlierState{}
+	}
+	target.outlier.ejectionCount++
+	duration := time.Duration(u.OutlierDetection.BaseEjectionTime*target.outlier.ejectionCount) * time.Second
+	target.outlier.ejection = &Ejection{
+		Address:       address,
+		Reason:        reason,
+		EjectedAt:     now,
+		EjectedUntil:  now.Add(duration),
+		EjectionCount: target.outlier.ejectionCount,
+	}
+	ejection := *target.outlier.ejection
+	return &ejection, true
+}
+
+// ReinstateExpired 恢复摘除已到期的节点，返回被恢复的节点地址
+// 未被摘除的节点每个周期将摘除次数减一，使摘除时长逐步回落
+func (u *Upstream) ReinstateExpired() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	var reinstated []string
+	for _, target := range u.Targets {
+		state := target.outlier
+		if state == nil || target.ejected(now) {
+			continue
+		}
+		if state.ejection != nil {
+			state.ejection = nil
+			reinstated = append(reinstated, target.Address)
+			continue
+		}
+		if state.ejectionCount > 0 {
+			state.ejectionCount--
+		}
+	}
+	return reinstated
+}
+
+// Ejections 获取当前处于摘除中的节点
+func (u *Upstream) Ejections() []Ejection {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	now := time.Now()
+	ejections := make([]Ejection, 0)
+	for _, target := range u.Targets {
+		if target.ejected(now) {
+			ejections = append(ejections, *target.outlier.ejection)
+		}
+	}
+	return ejections
+}
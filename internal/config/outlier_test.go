@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newOutlierUpstream(t *testing.T, targets, maxPercent int) *Upstream {
+	t.Helper()
+	upstream := &Upstream{
+		ID:               "u1",
+		Type:             LoadBalanceRoundRobin,
+		OutlierDetection: &OutlierDetection{Enabled: true, BaseEjectionTime: 10, MaxEjectionPercent: maxPercent},
+	}
+	for i := 0; i < targets; i++ {
+		upstream.Targets = append(upstream.Targets, &Target{
+			Address: fmt.Sprintf("10.0.0.%d:80", i+1),
+			Status:  TargetStatusHealthy,
+		})
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return upstream
+}
+
+func TestEjectTargetMaxPercent(t *testing.T) {
+	tests := []struct {
+		name       string
+		targets    int
+		maxPercent int
+		want       int // 最多可摘除的节点数
+	}{
+		{name: "at least one", targets: 4, maxPercent: 10, want: 1},
+		{name: "by percent", targets: 10, maxPercent: 30, want: 3},
+		{name: "never the whole pool", targets: 2, maxPercent: 100, want: 1},
+		{name: "single target", targets: 1, maxPercent: 100, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newOutlierUpstream(t, tt.targets, tt.maxPercent)
+			ejected := 0
+			for _, target := range upstream.Targets {
+				if _, ok := upstream.EjectTarget(target.Address, EjectionReasonSuccessRate); ok {
+					ejected++
+				}
+			}
+			if ejected != tt.want {
+				t.Fatalf("ejected %d targets, want %d", ejected, tt.want)
+			}
+			if got := len(upstream.GetHealthyTargets()); got != tt.targets-tt.want {
+				t.Fatalf("%d targets available, want %d", got, tt.targets-tt.want)
+			}
+		})
+	}
+}
+
+func TestEjectionBackoff(t *testing.T) {
+	upstream := newOutlierUpstream(t, 4, 50)
+	address := upstream.Targets[0].Address
+
+	for count := 1; count <= 3; count++ {
+		ejection, ok := upstream.EjectTarget(address, EjectionReasonLatency)
+		if !ok {
+			t.Fatalf("ejection %d rejected", count)
+		}
+		if ejection.EjectionCount != count {
+			t.Fatalf("ejection count = %d, want %d", ejection.EjectionCount, count)
+		}
+		if got := ejection.EjectedUntil.Sub(ejection.EjectedAt); got != time.Duration(10*count)*time.Second {
+			t.Fatalf("ejection %d lasts %s", count, got)
+		}
+
+		// 到期后恢复
+		upstream.Targets[0].outlier.ejection.EjectedUntil = time.Now().Add(-time.Second)
+		if got := upstream.ReinstateExpired(); len(got) != 1 || got[0] != address {
+			t.Fatalf("reinstated = %v, want [%s]", got, address)
+		}
+	}
+
+	// 未被摘除的周期逐步回落摘除次数
+	upstream.ReinstateExpired()
+	if got := upstream.Targets[0].outlier.ejectionCount; got != 2 {
+		t.Fatalf("ejection count after a clean interval = %d, want 2", got)
+	}
+}
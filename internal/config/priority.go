@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PriorityFailover 优先级故障转移配置
+// Target.Priority 数字越小优先级越高（默认 0），低优先级节点作为备份
+type PriorityFailover struct {
+	MinHealthyPercent int `json:"min_healthy_percent"` // 高优先级健康权重占比低于该值时启用下一优先级，默认 70
+}
+
+// defaultFailoverPercent 未配置 PriorityFailover 时的故障转移阈值
+const defaultFailoverPercent = 70
+
+// validate 校验故障转移配置并填充默认值
+func (pf *PriorityFailover) validate() error {
+	if pf.MinHealthyPercent < 0 || pf.MinHealthyPercent > 100 {
+		return fmt.Errorf("priority failover min_healthy_percent must be between 0 and 100")
+	}
+	if pf.MinHealthyPercent == 0 {
+		pf.MinHealthyPercent = defaultFailoverPercent
+	}
+	return nil
+}
+
+// selectPriorities 按优先级选择参与负载均衡的节点（调用方需持有锁）
+// 从最高优先级开始逐级纳入，直到某一级的健康权重占比达到阈值；
+// 高优先级恢复后自动回切。返回所选优先级范围内的全部节点和可用节点
+func (u *Upstream) selectPriorities(available []*Target) (scope, scopeAvailable []*Target) {
+	levels := make(map[int]bool)
+	for _, target := range u.Targets {
+		levels[target.Priority] = true
+	}
+	if len(levels) <= 1 {
+		return u.Targets, available
+	}
+
+	ordered := make([]int, 0, len(levels))
+	for level := range levels {
+		ordered = append(ordered, level)
+	}
+	sort.Ints(ordered)
+
+	threshold := defaultFailoverPercent
+	if u.PriorityFailover != nil {
+		threshold = u.PriorityFailover.MinHealthyPercent
+	}
+
+	isAvailable := make(map[*Target]bool, len(available))
+	for _, target := range available {
+		isAvailable[target] = true
+	}
+
+	maxLevel := ordered[len(ordered)-1]
+	for _, level := range ordered {
+		total, healthy := 0, 0
+		for _, target := range u.Targets {
+			if target.Priority != level {
+				continue
+			}
+			total += target.Weight
+			if isAvailable[target] {
+				healthy += target.Weight
+			}
+		}
+		if healthy*100 >= total*threshold {
+			maxLevel = level
+			break
+		}
+	}
+
+	for _, target := range u.Targets {
+		if target.Priority <= maxLevel {
+			scope = append(scope, target)
+			if isAvailable[target] {
+				scopeAvailable = append(scopeAvailable, target)
+			}
+		}
+	}
+	return scope, scopeAvailable
+}
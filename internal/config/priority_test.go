@@ -0,0 +1,68 @@
+package config
+
+import "testing"
+
+func TestPriorityFailover(t *testing.T) {
+	// 每一步修改节点状态后检查参与负载均衡的节点
+	type step struct {
+		status TargetStatus
+		change []string
+		want   string
+	}
+	tests := []struct {
+		name     string
+		failover *PriorityFailover
+		steps    []step
+	}{
+		{
+			name: "failover and fail-back",
+			steps: []step{
+				{want: "p0a,p0b"},
+				{status: TargetStatusUnhealthy, change: []string{"p0a"}, want: "p0b,p1a,p1b"},
+				{status: TargetStatusUnhealthy, change: []string{"p0b", "p1a"}, want: "p1b,p2"},
+				{status: TargetStatusHealthy, change: []string{"p1a"}, want: "p1a,p1b"},
+				{status: TargetStatusHealthy, change: []string{"p0a", "p0b"}, want: "p0a,p0b"},
+			},
+		},
+		{
+			name:     "custom threshold",
+			failover: &PriorityFailover{MinHealthyPercent: 50},
+			steps: []step{
+				{status: TargetStatusUnhealthy, change: []string{"p0a"}, want: "p0b"},
+				{status: TargetStatusUnhealthy, change: []string{"p0b"}, want: "p1a,p1b"},
+			},
+		},
+		{
+			name: "all backups down",
+			steps: []step{
+				{status: TargetStatusUnhealthy, change: []string{"p0a", "p1a", "p1b", "p2"}, want: "p0b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &Upstream{
+				ID:   "u1",
+				Type: LoadBalanceRoundRobin,
+				Targets: []*Target{
+					{Address: "p0a"}, {Address: "p0b"},
+					{Address: "p1a", Priority: 1}, {Address: "p1b", Priority: 1},
+					{Address: "p2", Priority: 2},
+				},
+				PriorityFailover: tt.failover,
+			}
+			if err := upstream.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range tt.steps {
+				for _, address := range s.change {
+					upstream.UpdateTargetStatus(address, s.status)
+				}
+				if got := availableAddresses(upstream); got != s.want {
+					t.Fatalf("step %d: available = %q, want %q", i, got, s.want)
+				}
+			}
+		})
+	}
+}
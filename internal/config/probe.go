@@ -0,0 +1,148 @@
+package config
+
+import "time"
+
+// probeHistorySize 每个节点保留的主动探测记录数
+const probeHistorySize = 20
+
+// ProbeResult 一次主动健康探测的结果
+type ProbeResult struct {
+	Latency time.Duration
+	Err     error // 为空表示探测成功
+}
+
+// ProbeRecord 主动探测记录（用于管理 API 展示）
+type ProbeRecord struct {
+	At        time.Time `json:"at"`
+	Healthy   bool      `json:"healthy"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ProbeEffect 探测结果引起的节点状态变化
+type ProbeEffect struct {
+	Changed      bool // 节点健康状态发生变化
+	Status       TargetStatus
+	SuccessCount int
+	FailCount    int
+}
+
+// TargetHealth 节点健康状态及最近的探测记录
+type TargetHealth struct {
+	Address      string        `json:"address"`
+	Status       TargetStatus  `json:"status"`
+	SuccessCount int           `json:"success_count"`
+	FailCount    int           `json:"fail_count"`
+	LastCheckAt  time.Time     `json:"last_check_at"`
+	LastFailAt   time.Time     `json:"last_fail_at"`
+	History      []ProbeRecord `json:"history"` // 按时间先后排列
+}
+
+// ReportProbe 上报一次主动探测结果，驱动节点健康状态机：
+// 未知状态节点首次探测成功即标记为健康，不健康节点连续成功 HealthyThreshold 次后标记为健康，
+// 非不健康节点连续失败 UnhealthyThreshold 次后标记为不健康
+func (u *Upstream) ReportProbe(address string, result ProbeResult) ProbeEffect {
+	var effect ProbeEffect
+	if !u.activeEnabled() {
+		return effect
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	for _, target := range u.Targets {
+		if target.Address != address {
+			continue
+		}
+
+		record := ProbeRecord{
+			At:        now,
+			Healthy:   result.Err == nil,
+			LatencyMs: float64(result.Latency) / float64(time.Millisecond),
+		}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+		}
+		target.probes = append(target.probes, record)
+		if n := len(target.probes); n > probeHistorySize {
+			target.probes = append([]ProbeRecord(nil), target.probes[n-probeHistorySize:]...)
+		}
+		target.LastCheckAt = now
+
+		if result.Err == nil {
+			target.successCount++
+			target.FailCount = 0
+			if target.Status == TargetStatusUnknown || target.Status != TargetStatusHealthy && target.successCount >= u.HealthCheck.HealthyThreshold {
+				target.Status = TargetStatusHealthy
+				target.passiveFails = 0
+				target.passiveEjected = false
+				target.warmupStart = now // 恢复健康的节点进入预热期
+				effect.Changed = true
+			}
+		} else {
+			target.FailCount++
+			target.successCount = 0
+			target.LastFailAt = now
+			if target.Status != TargetStatusUnhealthy && target.FailCount >= u.HealthCheck.UnhealthyThreshold {
+				target.Status = TargetStatusUnhealthy
+				effect.Changed = true
+			}
+		}
+
+		effect.Status = target.Status
+		effect.SuccessCount = target.successCount
+		effect.FailCount = target.FailCount
+		return effect
+	}
+	return effect
+}
+
+// HealthHistory 获取各节点的健康状态和最近的主动探测记录
+func (u *Upstream) HealthHistory() []TargetHealth {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	health := make([]TargetHealth, 0, len(u.Targets))
+	for _, target := range u.Targets {
+		history := make([]ProbeRecord, len(target.probes))
+		copy(history, target.probes)
+		health = append(health, TargetHealth{
+			Address:      target.Address,
+			Status:       target.Status,
+			SuccessCount: target.successCount,
+			FailCount:    target.FailCount,
+			LastCheckAt:  target.LastCheckAt,
+			LastFailAt:   target.LastFailAt,
+			History:      history,
+		})
+	}
+	return health
+}
+
+// ApplyStatus 应用外部同步的节点健康状态（集群共享健康检查的非 leader 节点），返回状态是否变化
+// 本地连续计数清零，回退到本地探测时从该状态重新计数
+func (u *Upstream) ApplyStatus(address string, status TargetStatus) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, target := range u.Targets {
+		if target.Address != address {
+			continue
+		}
+		if target.Status == status {
+			return false
+		}
+		// 恢复健康的节点进入预热期
+		if status == TargetStatusHealthy {
+			target.warmupStart = time.Now()
+		}
+		target.Status = status
+		target.successCount = 0
+		target.FailCount = 0
+		target.passiveFails = 0
+		target.passiveEjected = false
+		return true
+	}
+	return false
+}
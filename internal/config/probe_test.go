@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHealthStateMachine(t *testing.T) {
+	const address = "10.0.0.1:80"
+	errProbe := errors.New("connection refused")
+
+	// 每一步是一次主动探测（probe）或一次真实流量结果（status，0 表示连接错误）
+	type step struct {
+		probe  bool
+		err    error
+		status int
+		want   TargetStatus
+	}
+	tests := []struct {
+		name    string
+		initial TargetStatus
+		steps   []step
+	}{
+		{
+			name:    "consecutive probe failures mark unhealthy",
+			initial: TargetStatusHealthy,
+			steps: []step{
+				{probe: true, err: errProbe, want: TargetStatusHealthy},
+				{probe: true, err: errProbe, want: TargetStatusHealthy},
+				{probe: true, err: errProbe, want: TargetStatusUnhealthy},
+			},
+		},
+		{
+			name:    "first probe success marks unknown healthy",
+			initial: TargetStatusUnknown,
+			steps: []step{
+				{probe: true, want: TargetStatusHealthy},
+			},
+		},
+		{
+			name:    "unknown needs the full failure streak",
+			initial: TargetStatusUnknown,
+			steps: []step{
+				{probe: true, err: errProbe, want: TargetStatusUnknown},
+				{probe: true, err: errProbe, want: TargetStatusUnknown},
+				{probe: true, err: errProbe, want: TargetStatusUnhealthy},
+			},
+		},
+		{
+			name:    "consecutive probe successes mark healthy",
+			initial: TargetStatusUnhealthy,
+			steps: []step{
+				{probe: true, want: TargetStatusUnhealthy},
+				{probe: true, want: TargetStatusHealthy},
+			},
+		},
+		{
+			name:    "probe success resets failure streak",
+			initial: TargetStatusHealthy,
+			steps: []step{
+				{probe: true, err: errProbe}, {probe: true, err: errProbe},
+				{probe: true, want: TargetStatusHealthy},
+				{probe: true, err: errProbe}, {probe: true, err: errProbe},
+				{probe: true, err: errProbe, want: TargetStatusUnhealthy},
+			},
+		},
+		{
+			name:    "proxied success keeps active failure streak",
+			initial: TargetStatusHealthy,
+			steps: []step{
+				{probe: true, err: errProbe}, {probe: true, err: errProbe},
+				{status: 200, want: TargetStatusHealthy},
+				{probe: true, err: errProbe, want: TargetStatusUnhealthy},
+			},
+		},
+		{
+			name:    "passive failures mark unhealthy on their own",
+			initial: TargetStatusHealthy,
+			steps: []step{
+				{status: 502}, {status: 0},
+				{status: 503, want: TargetStatusUnhealthy},
+			},
+		},
+		{
+			name:    "probe success does not reset passive streak",
+			initial: TargetStatusHealthy,
+			steps: []step{
+				{status: 502}, {status: 502},
+				{probe: true, want: TargetStatusHealthy},
+				{status: 502, want: TargetStatusUnhealthy},
+			},
+		},
+		{
+			name:    "active recovery clears passive ejection",
+			initial: TargetStatusHealthy,
+			steps: []step{
+				{status: 502}, {status: 502},
+				{status: 502, want: TargetStatusUnhealthy},
+				{probe: true}, {probe: true, want: TargetStatusHealthy},
+				{status: 502}, {status: 502, want: TargetStatusHealthy},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &Upstream{
+				ID:      "u1",
+				Type:    LoadBalanceRoundRobin,
+				Targets: []*Target{{Address: address, Status: tt.initial}},
+				HealthCheck: &HealthCheck{
+					Enabled:            true,
+					Type:               HealthCheckTCP,
+					HealthyThreshold:   2,
+					UnhealthyThreshold: 3,
+					Passive:            &PassiveHealthCheck{Enabled: true},
+				},
+			}
+			if err := upstream.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range tt.steps {
+				if s.probe {
+					upstream.ReportProbe(address, ProbeResult{Err: s.err})
+				} else {
+					upstream.ReportResult(address, ProxyResult{StatusCode: s.status})
+				}
+				if got := upstream.TargetStates()[0].Status; s.want != "" && got != s.want {
+					t.Fatalf("step %d: status = %s, want %s", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestProbeHistoryCapped(t *testing.T) {
+	upstream := &Upstream{
+		ID:          "u1",
+		Type:        LoadBalanceRoundRobin,
+		Targets:     []*Target{{Address: "10.0.0.1:80"}},
+		HealthCheck: &HealthCheck{Enabled: true, Type: HealthCheckTCP},
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < probeHistorySize+5; i++ {
+		var err error
+		if i == probeHistorySize+4 {
+			err = errors.New("timeout")
+		}
+		upstream.ReportProbe("10.0.0.1:80", ProbeResult{Err: err})
+	}
+
+	history := upstream.HealthHistory()[0].History
+	if len(history) != probeHistorySize {
+		t.Fatalf("history length = %d, want %d", len(history), probeHistorySize)
+	}
+	if last := history[len(history)-1]; last.Healthy || last.Error != "timeout" {
+		t.Fatalf("latest record = %+v, want the failed probe", last)
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import "time"
+
+// ProxyResult 一次代理请求的结果
+type ProxyResult struct {
+	StatusCode int           // 响应状态码，0 表示连接错误或超时
+	Latency    time.Duration // 收到响应头（或出错）的耗时
+	Canceled   bool          // 客户端主动取消，不计入节点成败，只归还半开探测名额
+}
+
+// ResultEffect 上报结果引起的节点状态变化
+type ResultEffect struct {
+	BreakerChanged  bool
+	BreakerState    BreakerState
+	MarkedUnhealthy bool // 被动检查将节点标记为不健康
+	Recovered       bool // 被动摘除的节点恢复健康
+	FailCount       int  // 被动检查连续失败次数
+}
+
+// ReportResult 上报一次代理请求结果，驱动熔断器、被动健康检查、异常检测和延迟统计
+func (u *Upstream) ReportResult(address string, result ProxyResult) ResultEffect {
+	var effect ResultEffect
+	if !u.breakerEnabled() && !u.passiveEnabled() && !u.outlierEnabled() && !u.latencyTracked() {
+		return effect
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	for _, target := range u.Targets {
+		if target.Address != address {
+			continue
+		}
+
+		if result.Canceled {
+			if u.breakerEnabled() && target.breaker != nil {
+				target.breaker.release()
+			}
+			return effect
+		}
+
+		if u.breakerEnabled() {
+			if target.breaker == nil {
+				target.breaker = newBreaker(u.CircuitBreaker)
+			}
+			// 连接错误和 5xx 计为熔断失败
+			success := result.StatusCode != 0 && result.StatusCode < 500
+			effect.BreakerChanged = target.breaker.record(u.CircuitBreaker, success, now)
+			effect.BreakerState = target.breaker.state
+		}
+
+		if u.passiveEnabled() {
+			u.recordPassive(target, result, now, &effect)
+		}
+
+		if u.outlierEnabled() {
+			u.recordOutlier(target, result)
+		}
+
+		if u.latencyTracked() {
+			u.recordLatency(target, u.latencySample(result), now)
+		}
+		return effect
+	}
+	return effect
+}
+
+// passiveEnabled 是否启用被动健康检查
+func (u *Upstream) passiveEnabled() bool {
+	return u.HealthCheck != nil && u.HealthCheck.Passive != nil && u.HealthCheck.Passive.Enabled
+}
+
+// passiveOnly 是否仅启用被动健康检查
+func (u *Upstream) passiveOnly() bool {
+	return u.passiveEnabled() && !u.activeEnabled()
+}
+
+// passiveRecoveryDue 被动摘除的节点是否已到重新放行时间（调用方需持有锁）
+// 启用主动检查时由主动探测负责恢复
+func (u *Upstream) passiveRecoveryDue(target *Target, now time.Time) bool {
+	if !u.passiveOnly() || !target.passiveEjected {
+		return false
+	}
+	return now.Sub(target.LastFailAt) >= time.Duration(u.HealthCheck.Passive.RecoveryTime)*time.Second
+}
+
+// isPassiveFailure 判断结果是否计为被动检查失败
+func (u *Upstream) isPassiveFailure(result ProxyResult) bool {
+	if result.StatusCode == 0 {
+		return true
+	}
+	for _, status := range u.HealthCheck.Passive.UnhealthyStatuses {
+		if status == result.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPassive 根据真实流量结果更新节点健康状态（调用方需持有锁）
+// 使用独立的失败计数，不影响主动探测的连续失败计数
+func (u *Upstream) recordPassive(target *Target, result ProxyResult, now time.Time, effect *ResultEffect) {
+	if !u.isPassiveFailure(result) {
+		target.passiveFails = 0
+		// 被动摘除后放行的试探请求成功，恢复节点
+		if target.passiveEjected {
+			target.passiveEjected = false
+			target.Status = TargetStatusHealthy
+			target.warmupStart = now
+			effect.Recovered = true
+		}
+		return
+	}
+
+	target.passiveFails++
+	target.LastFailAt = now
+	effect.FailCount = target.passiveFails
+
+	if target.Status != TargetStatusUnhealthy && target.passiveFails >= u.HealthCheck.UnhealthyThreshold {
+		target.Status = TargetStatusUnhealthy
+		target.passiveEjected = true
+		effect.MarkedUnhealthy = true
+	}
+}
@@ -23,6 +23,7 @@ type Route struct {
 	Status     RouteStatus      `json:"status"`
 	Predicates *RoutePredicates `json:"predicates"`
 	UpstreamID string           `json:"upstream_id"`
+	Fallback   *RouteFallback   `json:"fallback,omitempty"`
 	Plugins    map[string]any   `json:"plugins,omitempty"`
 	Version    int64            `json:"version"` // 配置版本号
 	CreateTime int64            `json:"create_time"`
@@ -49,6 +50,65 @@ type RoutePredicates struct {
 	QueryParams map[string]string `json:"query_params,omitempty"`
 }
 
+// RouteFallback 路由级降级配置
+// 主上游没有可选节点或返回指定状态码时，按顺序尝试备用上游，全部失败后返回静态响应
+type RouteFallback struct {
+	UpstreamIDs []string        `json:"upstream_ids,omitempty"` // 按顺序尝试的备用上游
+	Statuses    []int           `json:"statuses,omitempty"`     // 触发降级的响应状态码，连接错误或超时总会触发降级
+	Response    *StaticResponse `json:"response,omitempty"`     // 全部上游失败时返回的静态响应
+	// 为重放而缓存的请求体上限(字节)，请求体更大时只转发到主上游，默认 1MB
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+}
+
+// defaultFallbackBodyBytes 降级重放缓存的默认请求体上限
+const defaultFallbackBodyBytes = 1 << 20
+
+// StaticResponse 静态响应
+type StaticResponse struct {
+	Status  int               `json:"status"` // 默认 503
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// MatchStatus 判断响应状态码是否触发降级
+func (f *RouteFallback) MatchStatus(status int) bool {
+	for _, s := range f.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 校验降级配置并填充默认值
+func (f *RouteFallback) validate() error {
+	for _, id := range f.UpstreamIDs {
+		if id == "" {
+			return fmt.Errorf("fallback upstream_id cannot be empty")
+		}
+	}
+	for _, status := range f.Statuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid fallback status: %d", status)
+		}
+	}
+	if f.MaxBodyBytes < 0 {
+		return fmt.Errorf("fallback max_body_bytes cannot be negative")
+	}
+	if f.MaxBodyBytes == 0 {
+		f.MaxBodyBytes = defaultFallbackBodyBytes
+	}
+	if f.Response != nil {
+		if f.Response.Status == 0 {
+			f.Response.Status = 503
+		}
+		if f.Response.Status < 100 || f.Response.Status > 599 {
+			return fmt.Errorf("invalid fallback response status: %d", f.Response.Status)
+		}
+	}
+	return nil
+}
+
 // PathType 路径匹配类型
 type PathType string
 
@@ -73,6 +133,13 @@ func (r *Route) Validate() error {
 		return fmt.Errorf("upstream_id cannot be empty")
 	}
 
+	// 验证降级配置
+	if r.Fallback != nil {
+		if err := r.Fallback.validate(); err != nil {
+			return err
+		}
+	}
+
 	// 验证并编译正则表达式
 	if r.Predicates.PathType == PathTypeRegex {
 		regex, err := regexp.Compile(r.Predicates.Path)
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// WeightScale 有效权重的放大倍数，保证小权重节点预热时也能平滑爬升
+const WeightScale = 100
+
+// SlowStartCurve 预热曲线
+type SlowStartCurve string
+
+const (
+	SlowStartLinear      SlowStartCurve = "linear"
+	SlowStartExponential SlowStartCurve = "exponential"
+)
+
+// SlowStart 慢启动配置
+// 节点恢复健康或新加入后，有效权重在 Window 秒内从最小值逐步升至配置的 Weight
+type SlowStart struct {
+	Enabled          bool           `json:"enabled"`
+	Window           int            `json:"window"`             // 预热时长(秒)
+	Curve            SlowStartCurve `json:"curve"`              // linear/exponential
+	MinWeightPercent int            `json:"min_weight_percent"` // 初始权重占比(%)
+}
+
+// validate 校验慢启动配置并填充默认值
+func (ss *SlowStart) validate() error {
+	if !ss.Enabled {
+		return nil
+	}
+	if ss.Curve == "" {
+		ss.Curve = SlowStartLinear
+	}
+	if ss.Curve != SlowStartLinear && ss.Curve != SlowStartExponential {
+		return fmt.Errorf("invalid slow start curve: %s", ss.Curve)
+	}
+	if ss.MinWeightPercent < 0 || ss.MinWeightPercent > 100 {
+		return fmt.Errorf("slow start min_weight_percent must be between 0 and 100")
+	}
+	if ss.Window == 0 {
+		ss.Window = 60
+	}
+	if ss.MinWeightPercent == 0 {
+		ss.MinWeightPercent = 10
+	}
+	return nil
+}
+
+// factor 计算预热进度对应的权重系数 (0-1]
+func (ss *SlowStart) factor(elapsed time.Duration) float64 {
+	window := time.Duration(ss.Window) * time.Second
+	if elapsed >= window {
+		return 1
+	}
+	progress := float64(elapsed) / float64(window)
+	min := float64(ss.MinWeightPercent) / 100
+
+	if ss.Curve == SlowStartExponential {
+		// 从 min 指数增长到 1
+		return min * math.Pow(1/min, progress)
+	}
+	return min + (1-min)*progress
+}
+
+// slowStartEnabled 是否启用慢启动
+func (u *Upstream) slowStartEnabled() bool {
+	return u.SlowStart != nil && u.SlowStart.Enabled
+}
+
+// EffectiveWeight 获取节点当前的有效权重（按 WeightScale 放大）
+// 处于预热期的节点权重按预热曲线折算
+func (u *Upstream) EffectiveWeight(target *Target) int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.effectiveWeight(target, time.Now())
+}
+
+// effectiveWeight 计算有效权重（调用方需持有锁）
+func (u *Upstream) effectiveWeight(target *Target, now time.Time) int {
+	weight := target.Weight * WeightScale
+	if !u.slowStartEnabled() || target.warmupStart.IsZero() {
+		return weight
+	}
+
+	effective := int(math.Round(float64(weight) * u.SlowStart.factor(now.Sub(target.warmupStart))))
+	if effective < 1 {
+		effective = 1
+	}
+	return effective
+}
+
+// StartWarmup 让节点进入预热期（节点新加入时调用）
+func (u *Upstream) StartWarmup(address string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, target := range u.Targets {
+		if target.Address == address {
+			target.warmupStart = time.Now()
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowStartEffectiveWeight(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name    string
+		curve   SlowStartCurve
+		elapsed time.Duration
+		warming bool
+		want    int
+	}{
+		{name: "not warming", curve: SlowStartLinear, want: 200},
+		{name: "linear start", curve: SlowStartLinear, warming: true, want: 20},
+		{name: "linear quarter", curve: SlowStartLinear, elapsed: 15 * time.Second, warming: true, want: 65},
+		{name: "linear half", curve: SlowStartLinear, elapsed: 30 * time.Second, warming: true, want: 110},
+		{name: "linear done", curve: SlowStartLinear, elapsed: 60 * time.Second, warming: true, want: 200},
+		{name: "linear past window", curve: SlowStartLinear, elapsed: 90 * time.Second, warming: true, want: 200},
+		{name: "exponential start", curve: SlowStartExponential, warming: true, want: 20},
+		{name: "exponential quarter", curve: SlowStartExponential, elapsed: 15 * time.Second, warming: true, want: 36},
+		{name: "exponential half", curve: SlowStartExponential, elapsed: 30 * time.Second, warming: true, want: 63},
+		{name: "exponential done", curve: SlowStartExponential, elapsed: 60 * time.Second, warming: true, want: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &Upstream{
+				ID:        "u1",
+				Type:      LoadBalanceWeighted,
+				Targets:   []*Target{{Address: "10.0.0.1:80", Weight: 2, Status: TargetStatusHealthy}},
+				SlowStart: &SlowStart{Enabled: true, Curve: tt.curve},
+			}
+			if err := upstream.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			target := upstream.Targets[0]
+			if tt.warming {
+				target.warmupStart = now.Add(-tt.elapsed)
+			}
+			if got := upstream.effectiveWeight(target, now); got != tt.want {
+				t.Fatalf("effective weight = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlowStartValidate(t *testing.T) {
+	ss := &SlowStart{Enabled: true}
+	if err := ss.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ss.Curve != SlowStartLinear || ss.Window != 60 || ss.MinWeightPercent != 10 {
+		t.Fatalf("defaults = %+v", ss)
+	}
+
+	for _, invalid := range []*SlowStart{
+		{Enabled: true, Curve: "quadratic"},
+		{Enabled: true, MinWeightPercent: 101},
+		{Enabled: true, MinWeightPercent: -1},
+	} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("%+v should be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import "time"
+
+// SmoothWeightedPick 平滑加权轮询 (nginx smooth weighted round-robin)
+// 每次选择时所有候选节点的当前权重加上有效权重，选出当前权重最大者并减去总权重。
+// 当前权重保存在节点上，候选列表变化或上游配置更新（见 InheritState）时不会重置。
+func (u *Upstream) SmoothWeightedPick(candidates []*Target) *Target {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	total := 0
+	var best *Target
+	for _, target := range candidates {
+		weight := u.effectiveWeight(target, now)
+		target.currentWeight += weight
+		total += weight
+		if best == nil || target.currentWeight > best.currentWeight {
+			best = target
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func newWeightedUpstream(t *testing.T, weights map[string]int, order ...string) *Upstream {
+	t.Helper()
+	upstream := &Upstream{ID: "u1", Type: LoadBalanceWeighted}
+	for _, address := range order {
+		upstream.Targets = append(upstream.Targets, &Target{Address: address, Weight: weights[address], Status: TargetStatusHealthy})
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return upstream
+}
+
+func pickSequence(upstream *Upstream, n int) string {
+	picks := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		picks = append(picks, upstream.SmoothWeightedPick(upstream.GetHealthyTargets()).Address)
+	}
+	return strings.Join(picks, "")
+}
+
+func TestSmoothWeightedPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]int
+		want    string
+	}{
+		{name: "nginx example", weights: map[string]int{"a": 5, "b": 1, "c": 1}, want: "aabacaa"},
+		{name: "equal weights", weights: map[string]int{"a": 1, "b": 1, "c": 1}, want: "abcabc"},
+		{name: "two to one", weights: map[string]int{"a": 2, "b": 1, "c": 0}, want: "abaaba"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newWeightedUpstream(t, tt.weights, "a", "b", "c")
+			if tt.weights["c"] == 0 {
+				upstream = newWeightedUpstream(t, tt.weights, "a", "b")
+			}
+			if got := pickSequence(upstream, len(tt.want)); got != tt.want {
+				t.Fatalf("sequence = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// 配置更新后继承当前权重，选择序列与未更新时一致
+func TestSmoothWeightedInheritState(t *testing.T) {
+	weights := map[string]int{"a": 5, "b": 1, "c": 1}
+	upstream := newWeightedUpstream(t, weights, "a", "b", "c")
+	got := pickSequence(upstream, 3)
+
+	updated := newWeightedUpstream(t, weights, "c", "b", "a")
+	updated.InheritState(upstream)
+	got += pickSequence(updated, 4)
+
+	if got != "aabacaa" {
+		t.Fatalf("sequence across update = %s, want aabacaa", got)
+	}
+}
+
+func TestInheritStateRuntime(t *testing.T) {
+	old := &Upstream{
+		ID:             "u1",
+		Type:           LoadBalanceRoundRobin,
+		Targets:        []*Target{{Address: "a"}, {Address: "b"}},
+		HealthCheck:    &HealthCheck{Enabled: true, HealthyThreshold: 1, UnhealthyThreshold: 1},
+		CircuitBreaker: &CircuitBreaker{Enabled: true, ConsecutiveFailures: 1},
+	}
+	if err := old.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	old.ReportProbe("a", ProbeResult{})
+	old.ReportResult("b", ProxyResult{StatusCode: 502})
+	old.IncrementActiveConns("a")
+
+	updated := &Upstream{
+		ID:             "u1",
+		Type:           LoadBalanceRoundRobin,
+		Targets:        []*Target{{Address: "a"}, {Address: "b"}},
+		HealthCheck:    &HealthCheck{Enabled: true, HealthyThreshold: 1, UnhealthyThreshold: 1},
+		CircuitBreaker: &CircuitBreaker{Enabled: true, ConsecutiveFailures: 1},
+	}
+	if err := updated.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	updated.InheritState(old)
+
+	states := updated.TargetStates()
+	if states[0].Status != TargetStatusHealthy || states[0].ActiveConns != 1 {
+		t.Fatalf("target a: status %s, active conns %d", states[0].Status, states[0].ActiveConns)
+	}
+	if states[1].Breaker != BreakerStateOpen {
+		t.Fatalf("target b: breaker %s, want open", states[1].Breaker)
+	}
+	if got := updated.GetHealthyTargets(); len(got) != 1 || got[0].Address != "a" {
+		t.Fatalf("available targets = %d, want only a", len(got))
+	}
+
+	// 在途请求在旧版本上结束，新版本的计数同步归零
+	old.DecrementActiveConns("a")
+	if got := updated.TargetStates()[0].ActiveConns; got != 0 {
+		t.Fatalf("active conns after old request finished = %d, want 0", got)
+	}
+
+	// 探测记录是副本，新旧版本互不影响
+	updated.ReportProbe("a", ProbeResult{})
+	if got, want := len(old.HealthHistory()[0].History), 1; got != want {
+		t.Fatalf("old probe history has %d records, want %d", got, want)
+	}
+}
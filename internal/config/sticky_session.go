@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StickySession 基于 Cookie 的会话保持配置
+// 首次请求由 Type 指定的策略选择节点，并下发签名的亲和 Cookie
+type StickySession struct {
+	Enabled    bool   `json:"enabled"`
+	CookieName string `json:"cookie_name"` // 默认 LG_AFFINITY
+	TTL        int    `json:"ttl"`         // Cookie 有效期(秒)
+	Path       string `json:"path"`
+	Domain     string `json:"domain,omitempty"`
+	Secure     bool   `json:"secure"`
+	HTTPOnly   bool   `json:"http_only"`
+	SameSite   string `json:"same_site,omitempty"` // lax/strict/none
+	Secret     string `json:"secret,omitempty"`    // 签名密钥，为空时使用进程随机密钥（多实例部署需配置）
+}
+
+// validate 校验会话保持配置并填充默认值
+func (ss *StickySession) validate() error {
+	if !ss.Enabled {
+		return nil
+	}
+	switch strings.ToLower(ss.SameSite) {
+	case "", "lax", "strict", "none":
+	default:
+		return fmt.Errorf("invalid sticky session same_site: %s", ss.SameSite)
+	}
+	if ss.CookieName == "" {
+		ss.CookieName = "LG_AFFINITY"
+	}
+	if ss.TTL == 0 {
+		ss.TTL = 3600
+	}
+	if ss.Path == "" {
+		ss.Path = "/"
+	}
+	return nil
+}
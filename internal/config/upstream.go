@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,38 +17,110 @@ const (
 	LoadBalanceLeastConn  LoadBalanceType = "least-conn"
 	LoadBalanceIPHash     LoadBalanceType = "ip-hash"
 	LoadBalanceRandom     LoadBalanceType = "random"
+
+	LoadBalanceConsistentHash LoadBalanceType = "consistent-hash"
+	LoadBalanceEWMA           LoadBalanceType = "ewma"
+)
+
+// HashSource 一致性哈希键来源
+type HashSource string
+
+const (
+	HashSourceIP        HashSource = "ip"         // 客户端 IP
+	HashSourceHeader    HashSource = "header"     // 请求头
+	HashSourceCookie    HashSource = "cookie"     // Cookie
+	HashSourceQuery     HashSource = "query"      // 查询参数
+	HashSourcePathParam HashSource = "path_param" // 路径参数
+	HashSourceJWTClaim  HashSource = "jwt_claim"  // JWT Claim
 )
 
+// HashOn 一致性哈希键配置，取不到键时回退为客户端 IP
+type HashOn struct {
+	Source HashSource `json:"source"`
+	Name   string     `json:"name,omitempty"` // header/cookie/query/path_param/jwt_claim 的名称
+}
+
 // Upstream 上游服务定义
 type Upstream struct {
-	ID          string          `json:"id"`
-	Name        string          `json:"name"`
-	Type        LoadBalanceType `json:"type"`
-	Targets     []*Target       `json:"targets"`
-	HealthCheck *HealthCheck    `json:"health_check,omitempty"`
-	Timeout     int             `json:"timeout"` // 请求超时(秒)
-	Retries     int             `json:"retries"` // 重试次数
-	Version     int64           `json:"version"`
-	CreateTime  int64           `json:"create_time"`
-	UpdateTime  int64           `json:"update_time"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Type             LoadBalanceType   `json:"type"`
+	Targets          []*Target         `json:"targets"`
+	Discovery        *Discovery        `json:"discovery,omitempty"`
+	HashOn           *HashOn           `json:"hash_on,omitempty"`
+	StickySession    *StickySession    `json:"sticky_session,omitempty"`
+	HealthCheck      *HealthCheck      `json:"health_check,omitempty"`
+	CircuitBreaker   *CircuitBreaker   `json:"circuit_breaker,omitempty"`
+	OutlierDetection *OutlierDetection `json:"outlier_detection,omitempty"`
+	SlowStart        *SlowStart        `json:"slow_start,omitempty"`
+	LocalityAware    *LocalityAware    `json:"locality_aware,omitempty"`
+	PriorityFailover *PriorityFailover `json:"priority_failover,omitempty"`
+	HealthPolicy     *HealthPolicy     `json:"health_policy,omitempty"`
+	Timeout          int               `json:"timeout"` // 请求超时(秒)
+	Retries          int               `json:"retries"` // 重试次数
+	Version          int64             `json:"version"`
+	CreateTime       int64             `json:"create_time"`
+	UpdateTime       int64             `json:"update_time"`
 
 	mu sync.RWMutex // 保护 Targets 状态变更
 }
 
 // Target 后端节点
 type Target struct {
-	Address  string            `json:"address"` // host:port
-	Weight   int               `json:"weight"`  // 权重(1-100)
+	Address  string            `json:"address"`            // host:port
+	Weight   int               `json:"weight"`             // 权重(1-100)
+	Priority int               `json:"priority,omitempty"` // 优先级，数字越小越优先，低优先级为备份节点
 	Status   TargetStatus      `json:"status"`
 	Metadata map[string]string `json:"metadata,omitempty"`
 
 	// 健康检查相关
-	FailCount   int       `json:"-"` // 连续失败次数
+	FailCount   int       `json:"-"` // 主动探测连续失败次数
 	LastCheckAt time.Time `json:"-"`
 	LastFailAt  time.Time `json:"-"`
 
-	// 连接数统计 (用于 least-conn)
-	ActiveConns int `json:"-"`
+	// 主动探测连续成功次数
+	successCount int
+	// 最近的主动探测记录
+	probes []ProbeRecord
+
+	// 在途请求数 (用于 least-conn)，上游配置更新时新旧版本的同一节点共享计数
+	conns *atomic.Int64
+
+	// 熔断器状态
+	breaker *breaker
+	// 被动健康检查（真实流量）连续失败次数
+	passiveFails int
+	// 是否由被动健康检查摘除
+	passiveEjected bool
+	// 异常检测状态
+	outlier *outlierState
+	// 慢启动预热开始时间
+	warmupStart time.Time
+	// 平滑加权轮询的当前权重
+	currentWeight int
+	// 响应延迟 EWMA (纳秒，用于 ewma)
+	latencyEWMA float64
+	latencyAt   time.Time
+}
+
+// TargetState 节点运行时状态快照（用于管理 API 展示）
+type TargetState struct {
+	Address      string       `json:"address"`
+	Weight       int          `json:"weight"`
+	Priority     int          `json:"priority"`
+	Status       TargetStatus `json:"status"`
+	ActiveConns  int          `json:"active_conns"`
+	FailCount    int          `json:"fail_count"`
+	SuccessCount int          `json:"success_count"`
+	PassiveFails int          `json:"passive_fail_count"`
+	LastCheckAt  time.Time    `json:"last_check_at"`
+	LastFailAt   time.Time    `json:"last_fail_at"`
+	Breaker      BreakerState `json:"breaker,omitempty"`
+	Ejection     *Ejection    `json:"ejection,omitempty"`
+
+	EffectiveWeight int     `json:"effective_weight"` // 按 WeightScale 放大
+	WarmingUp       bool    `json:"warming_up,omitempty"`
+	LatencyEWMA     float64 `json:"latency_ewma_ms,omitempty"`
 }
 
 // TargetStatus 节点状态
@@ -59,15 +132,21 @@ const (
 	TargetStatusUnknown   TargetStatus = "unknown"
 )
 
-// HealthCheck 健康检查配置
-type HealthCheck struct {
-	Enabled            bool   `json:"enabled"`
-	Type               string `json:"type"`                // http/tcp/grpc
-	Path               string `json:"path"`                // HTTP 检查路径
-	Interval           int    `json:"interval"`            // 检查间隔(秒)
-	Timeout            int    `json:"timeout"`             // 超时时间(秒)
-	HealthyThreshold   int    `json:"healthy_threshold"`   // 健康阈值
-	UnhealthyThreshold int    `json:"unhealthy_threshold"` // 不健康阈值
+// Validate 验证节点配置并设置默认权重，静态节点和服务发现得到的节点共用
+func (t *Target) Validate() error {
+	if t.Address == "" {
+		return fmt.Errorf("address cannot be empty")
+	}
+	if t.Weight < 1 {
+		t.Weight = 1 // 默认权重
+	}
+	if t.Weight > 100 {
+		return fmt.Errorf("weight must be between 1 and 100")
+	}
+	if t.Priority < 0 {
+		return fmt.Errorf("priority cannot be negative")
+	}
+	return nil
 }
 
 // Validate 验证上游配置
@@ -75,7 +154,12 @@ func (u *Upstream) Validate() error {
 	if u.ID == "" {
 		return fmt.Errorf("upstream id cannot be empty")
 	}
-	if len(u.Targets) == 0 {
+	if u.Discovery != nil {
+		if err := u.Discovery.validate(); err != nil {
+			return err
+		}
+	}
+	if len(u.Targets) == 0 && !u.discovered() {
 		return fmt.Errorf("upstream must have at least one target")
 	}
 
@@ -86,55 +170,236 @@ func (u *Upstream) Validate() error {
 		LoadBalanceLeastConn:  true,
 		LoadBalanceIPHash:     true,
 		LoadBalanceRandom:     true,
+
+		LoadBalanceConsistentHash: true,
+		LoadBalanceEWMA:           true,
 	}
 	if !validTypes[u.Type] {
 		return fmt.Errorf("invalid load balance type: %s", u.Type)
 	}
 
+	// 验证哈希键
+	if u.HashOn != nil {
+		switch u.HashOn.Source {
+		case "":
+			u.HashOn.Source = HashSourceIP
+		case HashSourceIP:
+		case HashSourceHeader, HashSourceCookie, HashSourceQuery, HashSourcePathParam, HashSourceJWTClaim:
+			if u.HashOn.Name == "" {
+				return fmt.Errorf("hash_on name cannot be empty for source %s", u.HashOn.Source)
+			}
+		default:
+			return fmt.Errorf("invalid hash_on source: %s", u.HashOn.Source)
+		}
+	}
+
 	// 验证 Targets
 	for i, target := range u.Targets {
-		if target.Address == "" {
-			return fmt.Errorf("target[%d] address cannot be empty", i)
-		}
-		if target.Weight < 1 {
-			target.Weight = 1 // 默认权重
+		if err := target.Validate(); err != nil {
+			return fmt.Errorf("target[%d] %w", i, err)
 		}
 		if target.Status == "" {
 			target.Status = TargetStatusUnknown
 		}
+		if target.conns == nil {
+			target.conns = new(atomic.Int64)
+		}
+	}
+
+	// 会话保持默认值
+	if u.StickySession != nil {
+		if err := u.StickySession.validate(); err != nil {
+			return err
+		}
+	}
+
+	// 熔断默认值
+	if u.CircuitBreaker != nil {
+		if err := u.CircuitBreaker.validate(); err != nil {
+			return err
+		}
 	}
 
-	// 健康检查默认值
-	if u.HealthCheck != nil && u.HealthCheck.Enabled {
-		if u.HealthCheck.Interval == 0 {
-			u.HealthCheck.Interval = 10
+	// 节点选择策略默认值
+	if u.HealthPolicy != nil {
+		if err := u.HealthPolicy.validate(); err != nil {
+			return err
 		}
-		if u.HealthCheck.Timeout == 0 {
-			u.HealthCheck.Timeout = 5
+	}
+
+	// 故障转移默认值
+	if u.PriorityFailover != nil {
+		if err := u.PriorityFailover.validate(); err != nil {
+			return err
 		}
-		if u.HealthCheck.HealthyThreshold == 0 {
-			u.HealthCheck.HealthyThreshold = 2
+	}
+
+	// 就近路由默认值
+	if u.LocalityAware != nil {
+		if err := u.LocalityAware.validate(); err != nil {
+			return err
 		}
+	}
+
+	// 慢启动默认值
+	if u.SlowStart != nil {
+		if err := u.SlowStart.validate(); err != nil {
+			return err
+		}
+	}
+
+	// 异常检测默认值
+	if u.OutlierDetection != nil {
+		if err := u.OutlierDetection.validate(); err != nil {
+			return err
+		}
+	}
+
+	// 被动健康检查默认值
+	if u.passiveEnabled() {
 		if u.HealthCheck.UnhealthyThreshold == 0 {
 			u.HealthCheck.UnhealthyThreshold = 3
 		}
+		if len(u.HealthCheck.Passive.UnhealthyStatuses) == 0 {
+			u.HealthCheck.Passive.UnhealthyStatuses = []int{500, 502, 503, 504}
+		}
+		if u.HealthCheck.Passive.RecoveryTime == 0 {
+			u.HealthCheck.Passive.RecoveryTime = 30
+		}
+	}
+
+	// 主动健康检查默认值
+	if u.HealthCheck != nil {
+		if err := u.HealthCheck.validate(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// GetHealthyTargets 获取健康的节点列表
+// GetHealthyTargets 获取可参与负载均衡的节点列表
+// 依次应用健康状态、熔断、异常摘除、恐慌模式、优先级和就近路由规则
 func (u *Upstream) GetHealthyTargets() []*Target {
 	u.mu.RLock()
 	defer u.mu.RUnlock()
 
-	healthy := make([]*Target, 0, len(u.Targets))
+	healthy := u.availableTargets()
+
+	// 恐慌模式：可用节点过少时不再失败关闭，改为忽略健康状态，
+	// 熔断打开和被异常摘除的节点仍然排除
+	if u.inPanic(len(healthy)) {
+		healthy = u.panicTargets()
+	}
+
+	// 先按优先级确定备份节点是否参与，再在范围内就近选择
+	scope, scopeHealthy := u.selectPriorities(healthy)
+	return u.preferLocal(scope, scopeHealthy)
+}
+
+// availableTargets 获取当前可用的节点（调用方需持有锁）
+func (u *Upstream) availableTargets() []*Target {
+	now := time.Now()
+	available := make([]*Target, 0, len(u.Targets))
 	for _, target := range u.Targets {
-		if target.Status == TargetStatusHealthy {
-			healthy = append(healthy, target)
+		if u.available(target, now) {
+			available = append(available, target)
 		}
 	}
-	return healthy
+	return available
+}
+
+// panicTargets 获取恐慌模式下的候选节点，不考虑健康状态（调用方需持有锁）
+func (u *Upstream) panicTargets() []*Target {
+	now := time.Now()
+	candidates := make([]*Target, 0, len(u.Targets))
+	for _, target := range u.Targets {
+		if u.selectable(target, now) {
+			candidates = append(candidates, target)
+		}
+	}
+	return candidates
+}
+
+// available 判断节点是否可参与负载均衡（调用方需持有锁）
+func (u *Upstream) available(target *Target, now time.Time) bool {
+	return u.healthy(target, now) && u.selectable(target, now)
+}
+
+// healthy 按健康状态判断节点是否可用（调用方需持有锁）
+func (u *Upstream) healthy(target *Target, now time.Time) bool {
+	switch target.Status {
+	case TargetStatusHealthy:
+		return true
+	case TargetStatusUnknown:
+		return u.unknownEligible()
+	default:
+		return u.passiveRecoveryDue(target, now)
+	}
+}
+
+// selectable 按熔断和异常摘除状态判断节点是否可被选中（调用方需持有锁）
+func (u *Upstream) selectable(target *Target, now time.Time) bool {
+	return !target.ejected(now) && u.breakerAllows(target, now)
+}
+
+// activeEnabled 是否启用主动健康检查
+func (u *Upstream) activeEnabled() bool {
+	return u.HealthCheck != nil && u.HealthCheck.Enabled
+}
+
+// breakerEnabled 是否启用熔断
+func (u *Upstream) breakerEnabled() bool {
+	return u.CircuitBreaker != nil && u.CircuitBreaker.Enabled
+}
+
+// breakerAllows 判断熔断器是否允许选中该节点（调用方需持有锁）
+func (u *Upstream) breakerAllows(target *Target, now time.Time) bool {
+	if !u.breakerEnabled() || target.breaker == nil {
+		return true
+	}
+	return target.breaker.allow(u.CircuitBreaker, now)
+}
+
+// TargetStates 获取所有节点的运行时状态快照
+func (u *Upstream) TargetStates() []TargetState {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	now := time.Now()
+	states := make([]TargetState, 0, len(u.Targets))
+	for _, target := range u.Targets {
+		state := TargetState{
+			Address:      target.Address,
+			Weight:       target.Weight,
+			Priority:     target.Priority,
+			Status:       target.Status,
+			ActiveConns:  target.ActiveConns(),
+			FailCount:    target.FailCount,
+			SuccessCount: target.successCount,
+			PassiveFails: target.passiveFails,
+			LastCheckAt:  target.LastCheckAt,
+			LastFailAt:   target.LastFailAt,
+
+			EffectiveWeight: u.effectiveWeight(target, now),
+		}
+		state.WarmingUp = state.EffectiveWeight < target.Weight*WeightScale
+		if !target.latencyAt.IsZero() {
+			state.LatencyEWMA = target.latencyEWMA / float64(time.Millisecond)
+		}
+		if u.breakerEnabled() {
+			state.Breaker = BreakerStateClosed
+			if target.breaker != nil {
+				state.Breaker = target.breaker.current(u.CircuitBreaker, now)
+			}
+		}
+		if target.ejected(now) {
+			ejection := *target.outlier.ejection
+			state.Ejection = &ejection
+		}
+		states = append(states, state)
+	}
+	return states
 }
 
 // UpdateTargetStatus 更新节点状态
@@ -144,41 +409,65 @@ func (u *Upstream) UpdateTargetStatus(address string, status TargetStatus) {
 
 	for _, target := range u.Targets {
 		if target.Address == address {
+			// 恢复健康的节点进入预热期
+			if status == TargetStatusHealthy && target.Status != TargetStatusHealthy {
+				target.warmupStart = time.Now()
+			}
 			target.Status = status
 			target.LastCheckAt = time.Now()
+			target.passiveFails = 0
+			target.passiveEjected = false
 			return
 		}
 	}
 }
 
-// IncrementActiveConns 增加活跃连接数
-func (u *Upstream) IncrementActiveConns(address string) {
+// IncrementActiveConns 增加活跃连接数，半开节点同时在写锁内占用探测名额
+// 选中后名额已被并发请求占满（或节点已熔断）时不增加并返回 false，调用方应重新选择节点
+func (u *Upstream) IncrementActiveConns(address string) bool {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
 	for _, target := range u.Targets {
 		if target.Address == address {
-			target.ActiveConns++
-			return
+			if u.breakerEnabled() && target.breaker != nil && !target.breaker.acquire(u.CircuitBreaker, time.Now()) {
+				return false
+			}
+			if target.conns == nil {
+				target.conns = new(atomic.Int64)
+			}
+			target.conns.Add(1)
+			return true
 		}
 	}
+	return true
 }
 
 // DecrementActiveConns 减少活跃连接数
 func (u *Upstream) DecrementActiveConns(address string) {
-	u.mu.Lock()
-	defer u.mu.Unlock()
+	u.mu.RLock()
+	defer u.mu.RUnlock()
 
 	for _, target := range u.Targets {
-		if target.Address == address && target.ActiveConns > 0 {
-			target.ActiveConns--
+		if target.Address == address && target.conns != nil {
+			target.conns.Add(-1)
 			return
 		}
 	}
 }
 
-// ToJSON 序列化为 JSON
+// ActiveConns 获取节点的在途请求数
+func (t *Target) ActiveConns() int {
+	if t.conns == nil {
+		return 0
+	}
+	return int(t.conns.Load())
+}
+
+// ToJSON 序列化为 JSON（持有读锁，可用于正在服务的上游）
 func (u *Upstream) ToJSON() ([]byte, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
 	return json.Marshal(u)
 }
 
@@ -0,0 +1,90 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// resolveDNS 将模板中的域名节点解析为每个 IP 一个节点，IP 节点原样保留
+func resolveDNS(ctx context.Context, templates []*config.Target) ([]*config.Target, error) {
+	targets := make([]*config.Target, 0, len(templates))
+	seen := make(map[string]bool)
+
+	for _, template := range templates {
+		host, port, err := net.SplitHostPort(template.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target address %s: %w", template.Address, err)
+		}
+
+		if net.ParseIP(host) != nil {
+			if !seen[template.Address] {
+				seen[template.Address] = true
+				targets = append(targets, newTarget(template, template.Address, host))
+			}
+			continue
+		}
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", host, err)
+		}
+		for _, addr := range addrs {
+			address := net.JoinHostPort(addr.IP.String(), port)
+			if !seen[address] {
+				seen[address] = true
+				targets = append(targets, newTarget(template, address, host))
+			}
+		}
+	}
+	return targets, nil
+}
+
+// resolveSRV 通过 SRV 记录获取节点，记录中的端口、权重和优先级映射到节点配置
+func resolveSRV(ctx context.Context, name string) ([]*config.Target, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup srv %s: %w", name, err)
+	}
+
+	targets := make([]*config.Target, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		weight := int(record.Weight)
+		if weight < 1 {
+			weight = 1
+		}
+		if weight > 100 {
+			weight = 100
+		}
+		targets = append(targets, &config.Target{
+			Address:  net.JoinHostPort(host, strconv.Itoa(int(record.Port))),
+			Weight:   weight,
+			Priority: int(record.Priority),
+			Status:   config.TargetStatusUnknown,
+			Metadata: map[string]string{"srv": name},
+		})
+	}
+	return targets, nil
+}
+
+// newTarget 基于模板创建解析后的节点
+func newTarget(template *config.Target, address, hostname string) *config.Target {
+	metadata := make(map[string]string, len(template.Metadata)+1)
+	for k, v := range template.Metadata {
+		metadata[k] = v
+	}
+	metadata[config.MetadataHostname] = hostname
+
+	return &config.Target{
+		Address:  address,
+		Weight:   template.Weight,
+		Priority: template.Priority,
+		Status:   config.TargetStatusUnknown,
+		Metadata: metadata,
+	}
+}
@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// 节点文件中的保留标签，其余标签作为节点元数据
+const (
+	labelWeight   = "__weight__"
+	labelPriority = "__priority__"
+)
+
+// fileGroup Prometheus file_sd 格式的一组节点
+type fileGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// loadFileTargets 读取并校验节点文件，任一节点非法时整个文件视为无效
+func loadFileTargets(path string) ([]*config.Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []fileGroup
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &groups)
+	default:
+		err = json.Unmarshal(data, &groups)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	targets := make([]*config.Target, 0)
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		weight, priority := 1, 0
+		metadata := make(map[string]string, len(group.Labels))
+		for key, value := range group.Labels {
+			switch key {
+			case labelWeight:
+				if weight, err = strconv.Atoi(value); err != nil || weight < 1 {
+					return nil, fmt.Errorf("invalid %s label: %s", labelWeight, value)
+				}
+			case labelPriority:
+				if priority, err = strconv.Atoi(value); err != nil || priority < 0 {
+					return nil, fmt.Errorf("invalid %s label: %s", labelPriority, value)
+				}
+			default:
+				metadata[key] = value
+			}
+		}
+
+		for _, address := range group.Targets {
+			if _, port, err := net.SplitHostPort(address); err != nil || port == "" {
+				return nil, fmt.Errorf("invalid target address: %s", address)
+			}
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+			targets = append(targets, &config.Target{
+				Address:  address,
+				Weight:   weight,
+				Priority: priority,
+				Status:   config.TargetStatusUnknown,
+				Metadata: metadata,
+			})
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,208 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/filewatch"
+)
+
+// Manager 服务发现管理器
+// 为启用服务发现的上游周期性刷新节点列表，刷新失败时保留上一次的结果
+type Manager struct {
+	watches map[string]*watch // upstream_id -> watch
+	logger  *zap.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+}
+
+// watch 单个上游的服务发现任务
+type watch struct {
+	upstream *config.Upstream
+	cancel   context.CancelFunc
+}
+
+// NewManager 创建服务发现管理器
+func NewManager(logger *zap.Logger) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		watches: make(map[string]*watch),
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start 启动服务发现
+func (m *Manager) Start() {
+	m.logger.Info("service discovery started")
+}
+
+// Stop 停止服务发现
+func (m *Manager) Stop() {
+	m.cancel()
+	m.logger.Info("service discovery stopped")
+}
+
+// AddUpstream 上游新增或更新时（重新）启动服务发现任务
+// 在上游发布到路由表之前调用：配置更新时沿用旧版本已解析的节点，
+// 否则同步完成首次解析，避免发布后到首次刷新前没有可用节点
+func (m *Manager) AddUpstream(upstream *config.Upstream) {
+	templates := templatesOf(upstream)
+	ctx, previous, ok := m.replaceWatch(upstream)
+	if !ok {
+		return
+	}
+
+	resolved := false
+	if previous == nil || !upstream.CarryTargets(previous) {
+		resolved = m.refresh(ctx, upstream, templates)
+	}
+	go m.run(ctx, upstream, templates, resolved)
+}
+
+// replaceWatch 取消上游的旧任务并登记新任务，返回旧版本上游和上游是否需要解析
+func (m *Manager) replaceWatch(upstream *config.Upstream) (context.Context, *config.Upstream, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var previous *config.Upstream
+	if w, ok := m.watches[upstream.ID]; ok {
+		w.cancel()
+		delete(m.watches, upstream.ID)
+		previous = w.upstream
+	}
+	if !resolvable(upstream) {
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.watches[upstream.ID] = &watch{upstream: upstream, cancel: cancel}
+	return ctx, previous, true
+}
+
+// resolvable 上游是否由本管理器解析（etcd 自注册由 ConfigWatcher 维护）
+func resolvable(upstream *config.Upstream) bool {
+	if upstream.Discovery == nil {
+		return false
+	}
+	switch upstream.Discovery.Type {
+	case config.DiscoveryDNS, config.DiscoverySRV, config.DiscoveryFile:
+		return true
+	}
+	return false
+}
+
+// RemoveUpstream 停止上游的服务发现任务
+func (m *Manager) RemoveUpstream(upstreamID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w, ok := m.watches[upstreamID]; ok {
+		w.cancel()
+		delete(m.watches, upstreamID)
+	}
+}
+
+// run 周期性刷新节点列表，file 类型在文件变化时立即刷新
+// resolved 表示首次解析已同步完成，否则立即刷新一次
+func (m *Manager) run(ctx context.Context, upstream *config.Upstream, templates []*config.Target, resolved bool) {
+	ticker := time.NewTicker(time.Duration(upstream.Discovery.TTL) * time.Second)
+	defer ticker.Stop()
+
+	var changes <-chan struct{}
+	if upstream.Discovery.Type == config.DiscoveryFile {
+		fw, err := filewatch.NewWatcher(upstream.Discovery.Path, func(err error) {
+			m.logger.Warn("discovery file watch error", zap.Error(err))
+		})
+		if err != nil {
+			// 无法监听时退化为按 TTL 周期重读
+			m.logger.Warn("failed to watch discovery file",
+				zap.String("upstream", upstream.ID),
+				zap.String("path", upstream.Discovery.Path),
+				zap.Error(err))
+		} else {
+			defer fw.Close()
+			changes = fw.Changes()
+		}
+	}
+
+	for {
+		if !resolved {
+			m.refresh(ctx, upstream, templates)
+		}
+		resolved = false
+
+		if !m.wait(ctx, ticker, changes) {
+			return
+		}
+	}
+}
+
+// wait 等待下一次刷新时机，任务取消时返回 false
+func (m *Manager) wait(ctx context.Context, ticker *time.Ticker, changes <-chan struct{}) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-ticker.C:
+		return true
+	case <-changes:
+		return true
+	}
+}
+
+// refresh 解析并替换节点列表，返回是否成功
+func (m *Manager) refresh(ctx context.Context, upstream *config.Upstream, templates []*config.Target) bool {
+	lookupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var targets []*config.Target
+	var err error
+	switch upstream.Discovery.Type {
+	case config.DiscoveryDNS:
+		targets, err = resolveDNS(lookupCtx, templates)
+	case config.DiscoverySRV:
+		targets, err = resolveSRV(lookupCtx, upstream.Discovery.Name)
+	case config.DiscoveryFile:
+		targets, err = loadFileTargets(upstream.Discovery.Path)
+	}
+	if err != nil || len(targets) == 0 {
+		// 任务已被取消（上游更新或删除）时不记录错误
+		if ctx.Err() == nil {
+			m.logger.Warn("service discovery failed, keeping last known targets",
+				zap.String("upstream", upstream.ID),
+				zap.String("type", string(upstream.Discovery.Type)),
+				zap.Error(err))
+		}
+		return false
+	}
+
+	added, removed := upstream.SetTargets(targets)
+	if len(added) > 0 || len(removed) > 0 {
+		m.logger.Info("upstream targets updated by service discovery",
+			zap.String("upstream", upstream.ID),
+			zap.Strings("added", added),
+			zap.Strings("removed", removed))
+	}
+	return true
+}
+
+// templatesOf 复制上游配置中的静态节点作为解析模板
+func templatesOf(upstream *config.Upstream) []*config.Target {
+	targets := upstream.AllTargets()
+	templates := make([]*config.Target, 0, len(targets))
+	for _, target := range targets {
+		templates = append(templates, &config.Target{
+			Address:  target.Address,
+			Weight:   target.Weight,
+			Priority: target.Priority,
+			Metadata: target.Metadata,
+		})
+	}
+	return templates
+}
@@ -0,0 +1,65 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+func newFileUpstream(t *testing.T, path string, timeout int) *config.Upstream {
+	t.Helper()
+	upstream := &config.Upstream{
+		ID:        "u1",
+		Type:      config.LoadBalanceRoundRobin,
+		Discovery: &config.Discovery{Type: config.DiscoveryFile, Path: path, TTL: 3600},
+		Timeout:   timeout,
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return upstream
+}
+
+func TestManagerResolvesBeforePublish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	if err := os.WriteFile(path, []byte(`[{"targets": ["10.0.0.1:80", "10.0.0.2:80"]}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(zap.NewNop())
+	defer m.Stop()
+
+	// 新上游：AddUpstream 返回时首次解析已完成
+	first := newFileUpstream(t, path, 10)
+	m.AddUpstream(first)
+	if got := len(first.GetHealthyTargets()); got != 2 {
+		t.Fatalf("new upstream has %d targets after AddUpstream, want 2", got)
+	}
+
+	// 配置更新：新版本立即沿用已解析的节点
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	first.IncrementActiveConns("10.0.0.1:80")
+	second := newFileUpstream(t, path, 20)
+	m.AddUpstream(second)
+
+	states := second.TargetStates()
+	if len(states) != 2 {
+		t.Fatalf("updated upstream has %d targets, want 2 carried over", len(states))
+	}
+	if states[0].ActiveConns != 1 {
+		t.Fatalf("carried target lost runtime state: active conns %d", states[0].ActiveConns)
+	}
+
+	// 发现来源变化时不沿用
+	other := newFileUpstream(t, path+".other", 10)
+	m.AddUpstream(other)
+	if got := len(other.AllTargets()); got != 0 {
+		t.Fatalf("upstream with a new source carried %d targets", got)
+	}
+}
@@ -0,0 +1,151 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/store"
+	"github.com/RunzhiZhao/long-gate/pkg/registry"
+)
+
+// DiscoveryPrefix 服务实例自注册前缀
+const DiscoveryPrefix = registry.Prefix
+
+// loadInstances 加载所有已注册的服务实例，返回加载时的存储版本
+func (w *ConfigWatcher) loadInstances(ctx context.Context) (int64, error) {
+	kvs, revision, err := w.store.List(ctx, DiscoveryPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, kv := range kvs {
+		w.kvs[kv.Key] = kv
+		w.putInstance(kv.Key, kv.Value)
+	}
+	return revision, nil
+}
+
+// handleDiscoveryEvent 处理服务实例注册和租约过期事件
+func (w *ConfigWatcher) handleDiscoveryEvent(event store.Event) {
+	key := event.Key
+
+	var service string
+	switch event.Type {
+	case store.EventPut:
+		service = w.putInstance(key, event.Value)
+	case store.EventDelete:
+		service = w.deleteInstance(key)
+	}
+	if service == "" {
+		return
+	}
+
+	for _, upstream := range w.upstreams {
+		if serviceOf(upstream) == service {
+			w.syncTargets(upstream)
+		}
+	}
+}
+
+// putInstance 解析并记录服务实例，返回服务名（解析或校验失败时为空）
+// 校验失败的实例不会加入节点列表，之前注册的同 Key 实例也会被移除
+func (w *ConfigWatcher) putInstance(key string, value []byte) string {
+	service, _ := splitInstanceKey(key)
+	instance := &registry.Instance{}
+	err := json.Unmarshal(value, instance)
+	if err == nil && service == "" {
+		err = fmt.Errorf("service name cannot be empty")
+	}
+	if err == nil {
+		err = instanceTarget(instance).Validate()
+	}
+	if err != nil {
+		w.logger.Error("invalid service instance",
+			zap.String("key", key),
+			zap.Error(err))
+		return w.deleteInstance(key)
+	}
+
+	if w.instances[service] == nil {
+		w.instances[service] = make(map[string]*registry.Instance)
+	}
+	w.instances[service][key] = instance
+	return service
+}
+
+// deleteInstance 移除服务实例，返回实例原先所属的服务名（不存在时为空）
+func (w *ConfigWatcher) deleteInstance(key string) string {
+	service, _ := splitInstanceKey(key)
+	instances, ok := w.instances[service]
+	if !ok || instances[key] == nil {
+		return ""
+	}
+	delete(instances, key)
+	if len(instances) == 0 {
+		delete(w.instances, service)
+	}
+	return service
+}
+
+// syncTargets 使用服务的当前实例替换上游节点列表
+func (w *ConfigWatcher) syncTargets(upstream *config.Upstream) {
+	instances := w.instances[serviceOf(upstream)]
+	keys := make([]string, 0, len(instances))
+	for key := range instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	targets := make([]*config.Target, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		instance := instances[key]
+		if seen[instance.Address] {
+			continue
+		}
+		seen[instance.Address] = true
+		target := instanceTarget(instance)
+		target.Validate() // 实例在 putInstance 中已校验，这里只设置默认权重
+		targets = append(targets, target)
+	}
+
+	added, removed := upstream.SetTargets(targets)
+	if len(added) > 0 || len(removed) > 0 {
+		w.logger.Info("discovered targets changed",
+			zap.String("upstream", upstream.ID),
+			zap.String("service", serviceOf(upstream)),
+			zap.Strings("added", added),
+			zap.Strings("removed", removed))
+	}
+}
+
+// instanceTarget 将服务实例转换为上游节点
+func instanceTarget(instance *registry.Instance) *config.Target {
+	return &config.Target{
+		Address:  instance.Address,
+		Weight:   instance.Weight,
+		Priority: instance.Priority,
+		Metadata: instance.Metadata,
+	}
+}
+
+// serviceOf 获取上游引用的自注册服务名，未使用 etcd 服务发现时为空
+func serviceOf(upstream *config.Upstream) string {
+	if upstream.Discovery == nil || upstream.Discovery.Type != config.DiscoveryEtcd {
+		return ""
+	}
+	return upstream.Discovery.Name
+}
+
+// splitInstanceKey 拆分实例 Key
+// 例: /gateway/discovery/user-service/user-1 -> user-service, user-1
+func splitInstanceKey(key string) (service, instanceID string) {
+	service, instanceID, _ = strings.Cut(extractID(key, DiscoveryPrefix), "/")
+	return service, instanceID
+}
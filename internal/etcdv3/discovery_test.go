@@ -0,0 +1,137 @@
+package etcdv3
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/router"
+	"github.com/RunzhiZhao/long-gate/internal/store"
+)
+
+func TestSplitInstanceKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		service  string
+		instance string
+	}{
+		{key: DiscoveryPrefix + "user-service/user-1", service: "user-service", instance: "user-1"},
+		{key: DiscoveryPrefix + "user-service/zone/a", service: "user-service", instance: "zone/a"},
+		{key: DiscoveryPrefix + "user-service", service: "user-service"},
+		{key: DiscoveryPrefix},
+	}
+	for _, tt := range tests {
+		service, instance := splitInstanceKey(tt.key)
+		if service != tt.service || instance != tt.instance {
+			t.Errorf("splitInstanceKey(%q) = %q, %q, want %q, %q", tt.key, service, instance, tt.service, tt.instance)
+		}
+	}
+}
+
+// targetsState 上游当前节点（地址/权重/优先级）
+func targetsState(upstream *config.Upstream) string {
+	items := make([]string, 0)
+	for _, target := range upstream.AllTargets() {
+		items = append(items, fmt.Sprintf("%s/%d/%d", target.Address, target.Weight, target.Priority))
+	}
+	return strings.Join(items, ",")
+}
+
+func TestSyncTargets(t *testing.T) {
+	instanceKey := func(id string) string { return DiscoveryPrefix + "user-service/" + id }
+	put := func(id, value string) store.Event {
+		return store.Event{Type: store.EventPut, Key: instanceKey(id), Value: []byte(value)}
+	}
+	del := func(id string) store.Event {
+		return store.Event{Type: store.EventDelete, Key: instanceKey(id)}
+	}
+
+	tests := []struct {
+		name   string
+		events []store.Event
+		want   string
+	}{
+		{
+			name: "register with default weight",
+			events: []store.Event{
+				put("a", `{"id": "a", "address": "10.0.0.1:80"}`),
+				put("b", `{"id": "b", "address": "10.0.0.2:80", "weight": 5, "priority": 1}`),
+			},
+			want: "10.0.0.1:80/1/0,10.0.0.2:80/5/1",
+		},
+		{
+			name: "duplicate address kept once",
+			events: []store.Event{
+				put("a", `{"id": "a", "address": "10.0.0.1:80", "weight": 2}`),
+				put("b", `{"id": "b", "address": "10.0.0.1:80", "weight": 3}`),
+			},
+			want: "10.0.0.1:80/2/0",
+		},
+		{
+			name: "lease expiry removes instance",
+			events: []store.Event{
+				put("a", `{"id": "a", "address": "10.0.0.1:80"}`),
+				put("b", `{"id": "b", "address": "10.0.0.2:80"}`),
+				del("a"),
+			},
+			want: "10.0.0.2:80/1/0",
+		},
+		{
+			name: "weight above 100 rejected",
+			events: []store.Event{
+				put("a", `{"id": "a", "address": "10.0.0.1:80"}`),
+				put("b", `{"id": "b", "address": "10.0.0.2:80", "weight": 1000}`),
+			},
+			want: "10.0.0.1:80/1/0",
+		},
+		{
+			name: "negative priority rejected",
+			events: []store.Event{
+				put("a", `{"id": "a", "address": "10.0.0.1:80"}`),
+				put("b", `{"id": "b", "address": "10.0.0.2:80", "priority": -1}`),
+			},
+			want: "10.0.0.1:80/1/0",
+		},
+		{
+			name: "invalid update removes previous instance",
+			events: []store.Event{
+				put("a", `{"id": "a", "address": "10.0.0.1:80"}`),
+				put("b", `{"id": "b", "address": "10.0.0.2:80"}`),
+				put("b", `{"id": "b", "address": ""}`),
+			},
+			want: "10.0.0.1:80/1/0",
+		},
+		{
+			name: "other services ignored",
+			events: []store.Event{
+				put("a", `{"id": "a", "address": "10.0.0.1:80"}`),
+				{Type: store.EventPut, Key: DiscoveryPrefix + "order-service/c", Value: []byte(`{"id": "c", "address": "10.0.0.3:80"}`)},
+			},
+			want: "10.0.0.1:80/1/0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &config.Upstream{
+				ID:        "u1",
+				Type:      config.LoadBalanceRoundRobin,
+				Discovery: &config.Discovery{Type: config.DiscoveryEtcd, Name: "user-service"},
+			}
+			if err := upstream.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			w := NewConfigWatcher(store.NewMemoryStore(), router.NewRouter(), zap.NewNop())
+			w.upstreams[upstream.ID] = upstream
+
+			for _, event := range tt.events {
+				w.handleDiscoveryEvent(event)
+			}
+			if got := targetsState(upstream); got != tt.want {
+				t.Fatalf("targets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package etcdv3
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/store"
+)
+
+// snapshotInterval 配置快照落盘的最小间隔，合并短时间内的连续变更
+const snapshotInterval = time.Second
+
+// snapshotFile 本地配置快照，保存最后一次从配置存储同步的全量配置
+type snapshotFile struct {
+	SavedAt   time.Time        `json:"saved_at"`
+	Revisions map[string]int64 `json:"revisions"` // prefix -> 存储版本
+	Items     []snapshotItem   `json:"items"`
+}
+
+// snapshotItem 快照中的配置项
+type snapshotItem struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Revision int64  `json:"revision"`
+}
+
+// saveSnapshot 配置有变化时将全量配置写入快照文件（在 run 协程中调用）
+// 降级模式下的配置来自快照本身，不回写
+func (w *ConfigWatcher) saveSnapshot() {
+	if w.snapshot == "" || !w.dirty || w.degraded.Load() {
+		return
+	}
+
+	snap := snapshotFile{
+		SavedAt:   time.Now(),
+		Revisions: w.heads,
+		Items:     make([]snapshotItem, 0, len(w.kvs)),
+	}
+	for _, kv := range w.kvs {
+		snap.Items = append(snap.Items, snapshotItem{Key: kv.Key, Value: string(kv.Value), Revision: kv.Revision})
+	}
+	sort.Slice(snap.Items, func(i, j int) bool { return snap.Items[i].Key < snap.Items[j].Key })
+
+	if err := writeSnapshot(w.snapshot, &snap); err != nil {
+		w.logger.Warn("failed to save config snapshot",
+			zap.String("snapshot", w.snapshot),
+			zap.Error(err))
+		return
+	}
+	w.dirty = false
+}
+
+// writeSnapshot 先写临时文件再重命名，避免进程退出时留下不完整的快照
+func writeSnapshot(path string, snap *snapshotFile) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadSnapshot 从快照文件恢复全量配置（在 run 协程启动前调用）
+func (w *ConfigWatcher) loadSnapshot() error {
+	data, err := os.ReadFile(w.snapshot)
+	if err != nil {
+		return err
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("parse snapshot: %w", err)
+	}
+
+	// 按前缀分组后以全量同步的方式应用，最终配置与快照一致
+	for _, prefix := range prefixes {
+		kvs := make([]store.KeyValue, 0)
+		for _, item := range snap.Items {
+			if strings.HasPrefix(item.Key, prefix) {
+				kvs = append(kvs, store.KeyValue{Key: item.Key, Value: []byte(item.Value), Revision: item.Revision})
+			}
+		}
+		w.apply(update{prefix: prefix, snapshot: kvs, resync: true, revision: snap.Revisions[prefix]})
+	}
+	w.publish()
+
+	w.logger.Info("loaded config snapshot",
+		zap.String("snapshot", w.snapshot),
+		zap.Time("saved_at", snap.SavedAt),
+		zap.Int("routes", len(w.routes)),
+		zap.Int("upstreams", len(w.upstreams)))
+	return nil
+}
+
+// reconnect 降级模式下重试读取配置存储，成功后全量重新同步并恢复监听
+func (w *ConfigWatcher) reconnect() {
+	backoff := minRetryBackoff
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		snapshots := make(map[string][]store.KeyValue, len(prefixes))
+		revisions := make(map[string]int64, len(prefixes))
+		var err error
+		for _, prefix := range prefixes {
+			if snapshots[prefix], revisions[prefix], err = w.list(prefix); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return
+			}
+			backoff = min(backoff*2, maxRetryBackoff)
+			w.logger.Warn("config store still unavailable, retrying",
+				zap.Duration("backoff", backoff),
+				zap.Error(err))
+			continue
+		}
+
+		for _, prefix := range prefixes {
+			w.send(update{prefix: prefix, snapshot: snapshots[prefix], resync: true, revision: revisions[prefix]})
+		}
+		w.degraded.Store(false)
+		for _, prefix := range prefixes {
+			go w.watchPrefix(prefix, revisions[prefix])
+		}
+		w.logger.Info("config store recovered, left degraded mode")
+		return
+	}
+}
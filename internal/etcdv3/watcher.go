@@ -2,250 +2,498 @@ package etcdv3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 
 	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/plugin"
 	"github.com/RunzhiZhao/long-gate/internal/router"
+	"github.com/RunzhiZhao/long-gate/internal/store"
+	"github.com/RunzhiZhao/long-gate/pkg/registry"
 )
 
 const (
-	// ETCD Key 前缀
-	RoutePrefix    = "/gateway/routes/"
-	UpstreamPrefix = "/gateway/upstreams/"
+	// 配置 Key 前缀
+	RoutePrefix    = store.RoutePrefix
+	UpstreamPrefix = store.UpstreamPrefix
 )
 
-// ConfigWatcher 配置监听器
+// prefixes 监听的配置前缀，服务实例先于上游应用，上游同步节点时实例已就绪
+var prefixes = []string{DiscoveryPrefix, UpstreamPrefix, RoutePrefix}
+
+// 监听重连的退避间隔
+const (
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+)
+
+// UpstreamListener 上游配置变更监听者
+// 回调在 run 协程中、新配置发布到路由表之前同步执行
+type UpstreamListener interface {
+	AddUpstream(upstream *config.Upstream)
+	RemoveUpstream(upstreamID string)
+}
+
+// ConfigWatcher 配置监听器，从配置存储加载并监听路由和上游
+// routes/upstreams 等为配置工作副本，只在加载和 run 协程中修改，请求通过 router 快照读取
 type ConfigWatcher struct {
-	client    *clientv3.Client
+	store     store.ConfigStore
 	router    *router.Router
-	upstreams map[string]*config.Upstream // upstream_id -> Upstream
+	routes    map[string]*config.Route                 // route_id -> Route
+	upstreams map[string]*config.Upstream              // upstream_id -> Upstream
+	instances map[string]map[string]*registry.Instance // service -> key -> Instance
+	kvs       map[string]store.KeyValue                // key -> 已应用的配置项
+	heads     map[string]int64                         // prefix -> 已应用的存储版本
+	updates   chan update
+	listeners []UpstreamListener
+	snapshot  string      // 本地配置快照文件路径，为空时不持久化
+	dirty     bool        // 快照落盘后配置是否有变化
+	degraded  atomic.Bool // 配置存储不可用，正在使用本地快照
 	logger    *zap.Logger
 	ctx       context.Context
 	cancel    context.CancelFunc
 }
 
+// update 一批待应用的配置变更
+type update struct {
+	prefix   string
+	events   []store.Event
+	snapshot []store.KeyValue // 全量重新同步时前缀下的全部配置项
+	resync   bool
+	revision int64 // 该批变更对应的存储版本
+}
+
 // NewConfigWatcher 创建配置监听器
-func NewConfigWatcher(client *clientv3.Client, r *router.Router, logger *zap.Logger) *ConfigWatcher {
+func NewConfigWatcher(configStore store.ConfigStore, r *router.Router, logger *zap.Logger) *ConfigWatcher {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &ConfigWatcher{
-		client:    client,
+		store:     configStore,
 		router:    r,
+		routes:    make(map[string]*config.Route),
 		upstreams: make(map[string]*config.Upstream),
+		instances: make(map[string]map[string]*registry.Instance),
+		kvs:       make(map[string]store.KeyValue),
+		heads:     make(map[string]int64),
+		updates:   make(chan update),
 		logger:    logger,
 		ctx:       ctx,
 		cancel:    cancel,
 	}
 }
 
+// AddUpstreamListener 注册上游变更监听者（需在 Start 之前调用）
+func (w *ConfigWatcher) AddUpstreamListener(l UpstreamListener) {
+	w.listeners = append(w.listeners, l)
+}
+
+// SetSnapshotPath 设置本地配置快照文件（需在 Start 之前调用）
+// 配置变化后定期落盘，启动时配置存储不可用则从快照恢复
+func (w *ConfigWatcher) SetSnapshotPath(path string) {
+	w.snapshot = path
+}
+
 // Start 启动监听
 func (w *ConfigWatcher) Start() error {
 	// 1. 首次加载全量配置
-	if err := w.loadAllConfigs(); err != nil {
-		return fmt.Errorf("failed to load initial configs: %w", err)
+	revisions, err := w.loadAllConfigs()
+	if err != nil {
+		if w.snapshot == "" {
+			return fmt.Errorf("failed to load initial configs: %w", err)
+		}
+		// 配置存储不可用时从本地快照启动，后台重试连接
+		if snapErr := w.loadSnapshot(); snapErr != nil {
+			return fmt.Errorf("failed to load initial configs: %w (snapshot: %v)", err, snapErr)
+		}
+		w.degraded.Store(true)
+		w.logger.Error("config store unavailable, serving from local snapshot",
+			zap.String("snapshot", w.snapshot),
+			zap.Error(err))
+		go w.run()
+		go w.reconnect()
+		return nil
 	}
+	w.heads = revisions
+	w.dirty = true
 
-	// 2. 启动 Watch 协程
-	go w.watchRoutes()
-	go w.watchUpstreams()
+	// 2. 启动 Watch 协程，从加载时的版本之后开始监听
+	go w.run()
+	for _, prefix := range prefixes {
+		go w.watchPrefix(prefix, revisions[prefix])
+	}
 
 	w.logger.Info("config watcher started")
 	return nil
 }
 
+// Degraded 是否处于降级模式：配置存储不可用，使用本地快照提供服务
+func (w *ConfigWatcher) Degraded() bool {
+	return w.degraded.Load()
+}
+
 // Stop 停止监听
 func (w *ConfigWatcher) Stop() {
 	w.cancel()
 	w.logger.Info("config watcher stopped")
 }
 
-// loadAllConfigs 加载全量配置
-func (w *ConfigWatcher) loadAllConfigs() error {
+// loadAllConfigs 加载全量配置，返回各前缀加载时的存储版本
+func (w *ConfigWatcher) loadAllConfigs() (map[string]int64, error) {
 	ctx, cancel := context.WithTimeout(w.ctx, 10*time.Second)
 	defer cancel()
 
+	revisions := make(map[string]int64)
+	var err error
+
 	// 加载路由
-	routes, err := w.loadRoutes(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to load routes: %w", err)
+	var routes []*config.Route
+	if routes, revisions[RoutePrefix], err = w.loadRoutes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load routes: %w", err)
 	}
-	if err := w.router.LoadRoutes(routes); err != nil {
-		return fmt.Errorf("failed to initialize router: %w", err)
+	for _, route := range routes {
+		w.routes[route.ID] = route
+	}
+
+	// 加载自注册的服务实例
+	if revisions[DiscoveryPrefix], err = w.loadInstances(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load service instances: %w", err)
 	}
 
 	// 加载上游
-	upstreams, err := w.loadUpstreams(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to load upstreams: %w", err)
+	var upstreams []*config.Upstream
+	if upstreams, revisions[UpstreamPrefix], err = w.loadUpstreams(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load upstreams: %w", err)
 	}
 	for _, upstream := range upstreams {
+		if serviceOf(upstream) != "" {
+			w.syncTargets(upstream)
+		}
 		w.upstreams[upstream.ID] = upstream
+		w.notifyUpstreamAdded(upstream)
 	}
+	w.publish()
 
 	w.logger.Info("loaded initial configs",
 		zap.Int("routes", len(routes)),
 		zap.Int("upstreams", len(upstreams)))
-	return nil
+	return revisions, nil
 }
 
-// loadRoutes 从 ETCD 加载所有路由
-func (w *ConfigWatcher) loadRoutes(ctx context.Context) ([]*config.Route, error) {
-	resp, err := w.client.Get(ctx, RoutePrefix, clientv3.WithPrefix())
+// loadRoutes 从配置存储加载所有路由
+func (w *ConfigWatcher) loadRoutes(ctx context.Context) ([]*config.Route, int64, error) {
+	kvs, revision, err := w.store.List(ctx, RoutePrefix)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	routes := make([]*config.Route, 0, len(resp.Kvs))
-	for _, kv := range resp.Kvs {
-		route := &config.Route{}
-		if err := route.FromJSON(kv.Value); err != nil {
+	routes := make([]*config.Route, 0, len(kvs))
+	for _, kv := range kvs {
+		w.kvs[kv.Key] = kv
+		route, err := parseRoute(kv.Value)
+		if err != nil {
 			w.logger.Error("failed to parse route",
-				zap.String("key", string(kv.Key)),
+				zap.String("key", kv.Key),
 				zap.Error(err))
 			continue
 		}
 		routes = append(routes, route)
 	}
-	return routes, nil
+	return routes, revision, nil
 }
 
-// loadUpstreams 从 ETCD 加载所有上游
-func (w *ConfigWatcher) loadUpstreams(ctx context.Context) ([]*config.Upstream, error) {
-	resp, err := w.client.Get(ctx, UpstreamPrefix, clientv3.WithPrefix())
+// loadUpstreams 从配置存储加载所有上游
+func (w *ConfigWatcher) loadUpstreams(ctx context.Context) ([]*config.Upstream, int64, error) {
+	kvs, revision, err := w.store.List(ctx, UpstreamPrefix)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	upstreams := make([]*config.Upstream, 0, len(resp.Kvs))
-	for _, kv := range resp.Kvs {
+	upstreams := make([]*config.Upstream, 0, len(kvs))
+	for _, kv := range kvs {
+		w.kvs[kv.Key] = kv
 		upstream := &config.Upstream{}
 		if err := upstream.FromJSON(kv.Value); err != nil {
 			w.logger.Error("failed to parse upstream",
-				zap.String("key", string(kv.Key)),
+				zap.String("key", kv.Key),
 				zap.Error(err))
 			continue
 		}
 		upstreams = append(upstreams, upstream)
 	}
-	return upstreams, nil
+	return upstreams, revision, nil
 }
 
-// watchRoutes 监听路由变化
-func (w *ConfigWatcher) watchRoutes() {
-	watchChan := w.client.Watch(w.ctx, RoutePrefix, clientv3.WithPrefix())
-
+// watchPrefix 监听前缀下的变更并交给 run 协程应用
+// 断线后从最后应用的版本继续监听，版本已被压缩时全量重新同步，重连间隔指数退避
+func (w *ConfigWatcher) watchPrefix(prefix string, revision int64) {
+	backoff := minRetryBackoff
 	for {
-		select {
-		case <-w.ctx.Done():
+		var err error
+		for resp := range w.store.Watch(w.ctx, prefix, revision+1) {
+			if resp.Err != nil {
+				err = resp.Err
+				break
+			}
+			if len(resp.Events) > 0 {
+				revision = resp.Events[len(resp.Events)-1].Revision
+				w.send(update{prefix: prefix, events: resp.Events, revision: revision})
+			}
+			backoff = minRetryBackoff
+		}
+		if w.ctx.Err() != nil {
 			return
-		case watchResp := <-watchChan:
-			if watchResp.Err() != nil {
-				w.logger.Error("watch routes error", zap.Error(watchResp.Err()))
-				// 重连逻辑
-				time.Sleep(5 * time.Second)
-				watchChan = w.client.Watch(w.ctx, RoutePrefix, clientv3.WithPrefix())
+		}
+
+		if errors.Is(err, store.ErrCompacted) {
+			// 断线期间的变更历史已被压缩，只能全量重新同步
+			w.logger.Warn("watch revision compacted, resyncing",
+				zap.String("prefix", prefix),
+				zap.Int64("revision", revision+1),
+				zap.Error(err))
+			kvs, current, listErr := w.list(prefix)
+			if listErr == nil {
+				w.send(update{prefix: prefix, snapshot: kvs, resync: true, revision: current})
+				revision = current
 				continue
 			}
+			err = listErr
+		}
+		if err == nil {
+			err = errors.New("watch channel closed")
+		}
 
-			for _, event := range watchResp.Events {
-				w.handleRouteEvent(event)
-			}
+		w.logger.Error("watch error, retrying",
+			zap.String("prefix", prefix),
+			zap.Int64("resume_revision", revision+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(backoff):
 		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// list 全量读取前缀下的配置项
+func (w *ConfigWatcher) list(prefix string) ([]store.KeyValue, int64, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, 10*time.Second)
+	defer cancel()
+	return w.store.List(ctx, prefix)
+}
+
+// send 将变更交给 run 协程
+func (w *ConfigWatcher) send(u update) {
+	select {
+	case w.updates <- u:
+	case <-w.ctx.Done():
 	}
 }
 
-// watchUpstreams 监听上游变化
-func (w *ConfigWatcher) watchUpstreams() {
-	watchChan := w.client.Watch(w.ctx, UpstreamPrefix, clientv3.WithPrefix())
+// run 串行应用所有前缀的变更，配置状态只在该协程中修改，
+// 每批变更应用后发布新的配置快照供请求读取，并定期落盘到本地快照文件
+func (w *ConfigWatcher) run() {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-w.ctx.Done():
+			w.saveSnapshot()
 			return
-		case watchResp := <-watchChan:
-			if watchResp.Err() != nil {
-				w.logger.Error("watch upstreams error", zap.Error(watchResp.Err()))
-				time.Sleep(5 * time.Second)
-				watchChan = w.client.Watch(w.ctx, UpstreamPrefix, clientv3.WithPrefix())
-				continue
-			}
-
-			for _, event := range watchResp.Events {
-				w.handleUpstreamEvent(event)
-			}
+		case u := <-w.updates:
+			w.apply(u)
+		case <-ticker.C:
+			w.saveSnapshot()
 		}
 	}
 }
 
-// handleRouteEvent 处理路由事件
-func (w *ConfigWatcher) handleRouteEvent(event *clientv3.Event) {
-	routeID := extractID(string(event.Kv.Key), RoutePrefix)
+// apply 应用一批变更并记录各配置项的版本
+func (w *ConfigWatcher) apply(u update) {
+	if u.revision > w.heads[u.prefix] {
+		w.heads[u.prefix] = u.revision
+		w.dirty = true
+	}
 
-	switch event.Type {
-	case clientv3.EventTypePut:
-		route := &config.Route{}
-		if err := route.FromJSON(event.Kv.Value); err != nil {
-			w.logger.Error("failed to parse route from watch event",
-				zap.String("key", string(event.Kv.Key)),
-				zap.Error(err))
-			return
+	events := u.events
+	if u.resync {
+		events = w.diff(u.prefix, u.snapshot)
+		w.logger.Info("resynced configs",
+			zap.String("prefix", u.prefix),
+			zap.Int("changes", len(events)))
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	switch u.prefix {
+	case RoutePrefix:
+		w.handleRouteEvents(events)
+	case UpstreamPrefix:
+		for _, event := range events {
+			w.handleUpstreamEvent(event)
+		}
+	case DiscoveryPrefix:
+		for _, event := range events {
+			w.handleDiscoveryEvent(event)
 		}
+	}
 
-		if err := w.router.AddRoute(route); err != nil {
-			w.logger.Error("failed to add/update route",
-				zap.String("route_id", routeID),
-				zap.Error(err))
-			return
+	for _, event := range events {
+		if event.Type == store.EventDelete {
+			delete(w.kvs, event.Key)
+		} else {
+			w.kvs[event.Key] = store.KeyValue{Key: event.Key, Value: event.Value, Revision: event.Revision}
 		}
+	}
+	w.publish()
+}
 
-		w.logger.Info("route updated", zap.String("route_id", routeID))
+// publish 将当前的路由和上游作为新一代配置快照原子发布
+func (w *ConfigWatcher) publish() {
+	routes := make([]*config.Route, 0, len(w.routes))
+	for _, route := range w.routes {
+		routes = append(routes, route)
+	}
+	upstreams := make(map[string]*config.Upstream, len(w.upstreams))
+	for id, upstream := range w.upstreams {
+		upstreams[id] = upstream
+	}
+	if err := w.router.Publish(routes, upstreams); err != nil {
+		w.logger.Error("failed to build route plugins, routes skipped", zap.Error(err))
+	}
+}
 
-	case clientv3.EventTypeDelete:
-		if err := w.router.DeleteRoute(routeID); err != nil {
-			w.logger.Error("failed to delete route",
-				zap.String("route_id", routeID),
-				zap.Error(err))
-			return
+// diff 比较全量配置与当前已应用的版本，转换为变更事件
+func (w *ConfigWatcher) diff(prefix string, snapshot []store.KeyValue) []store.Event {
+	events := make([]store.Event, 0)
+	seen := make(map[string]bool, len(snapshot))
+	for _, kv := range snapshot {
+		seen[kv.Key] = true
+		if w.kvs[kv.Key].Revision != kv.Revision {
+			events = append(events, store.Event{Type: store.EventPut, Key: kv.Key, Value: kv.Value, Revision: kv.Revision})
+		}
+	}
+	for key := range w.kvs {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			events = append(events, store.Event{Type: store.EventDelete, Key: key})
 		}
+	}
+	return events
+}
 
-		w.logger.Info("route deleted", zap.String("route_id", routeID))
+// handleRouteEvents 处理一批路由事件
+func (w *ConfigWatcher) handleRouteEvents(events []store.Event) {
+	for _, event := range events {
+		routeID := extractID(event.Key, RoutePrefix)
+
+		switch event.Type {
+		case store.EventPut:
+			// 解析或插件配置校验失败时保留该路由的上一个版本
+			route, err := parseRoute(event.Value)
+			if err != nil {
+				w.logger.Error("failed to parse route from watch event, keeping previous version",
+					zap.String("key", event.Key),
+					zap.Error(err))
+				continue
+			}
+			w.routes[routeID] = route
+			w.logger.Info("route updated", zap.String("route_id", routeID))
+
+		case store.EventDelete:
+			delete(w.routes, routeID)
+			w.logger.Info("route deleted", zap.String("route_id", routeID))
+		}
 	}
 }
 
+// parseRoute 解析并校验路由，包括插件配置（与管理 API 写入时的校验一致）
+func parseRoute(data []byte) (*config.Route, error) {
+	route := &config.Route{}
+	if err := route.FromJSON(data); err != nil {
+		return nil, err
+	}
+	if err := plugin.Validate(route.Plugins); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
 // handleUpstreamEvent 处理上游事件
-func (w *ConfigWatcher) handleUpstreamEvent(event *clientv3.Event) {
-	upstreamID := extractID(string(event.Kv.Key), UpstreamPrefix)
+func (w *ConfigWatcher) handleUpstreamEvent(event store.Event) {
+	upstreamID := extractID(event.Key, UpstreamPrefix)
 
 	switch event.Type {
-	case clientv3.EventTypePut:
+	case store.EventPut:
 		upstream := &config.Upstream{}
-		if err := upstream.FromJSON(event.Kv.Value); err != nil {
+		if err := upstream.FromJSON(event.Value); err != nil {
 			w.logger.Error("failed to parse upstream from watch event",
-				zap.String("key", string(event.Kv.Key)),
+				zap.String("key", event.Key),
 				zap.Error(err))
 			return
 		}
 
+		if serviceOf(upstream) != "" {
+			w.syncTargets(upstream)
+		}
+
+		if old, ok := w.upstreams[upstreamID]; ok {
+			// 继承负载均衡状态，新加入的节点进入慢启动预热
+			upstream.InheritState(old)
+			for _, target := range upstream.AllTargets() {
+				if !hasTarget(old, target.Address) {
+					upstream.StartWarmup(target.Address)
+				}
+			}
+		}
+
 		w.upstreams[upstreamID] = upstream
+		w.notifyUpstreamAdded(upstream)
 		w.logger.Info("upstream updated", zap.String("upstream_id", upstreamID))
 
-	case clientv3.EventTypeDelete:
+	case store.EventDelete:
 		delete(w.upstreams, upstreamID)
+		w.notifyUpstreamRemoved(upstreamID)
 		w.logger.Info("upstream deleted", zap.String("upstream_id", upstreamID))
 	}
 }
 
-// GetUpstream 获取上游服务
+// notifyUpstreamAdded 通知监听者上游新增或更新
+func (w *ConfigWatcher) notifyUpstreamAdded(upstream *config.Upstream) {
+	for _, l := range w.listeners {
+		l.AddUpstream(upstream)
+	}
+}
+
+// notifyUpstreamRemoved 通知监听者上游删除
+func (w *ConfigWatcher) notifyUpstreamRemoved(upstreamID string) {
+	for _, l := range w.listeners {
+		l.RemoveUpstream(upstreamID)
+	}
+}
+
+// GetUpstream 获取当前配置快照中的上游服务
 func (w *ConfigWatcher) GetUpstream(id string) (*config.Upstream, bool) {
-	upstream, ok := w.upstreams[id]
-	return upstream, ok
+	return w.router.GetUpstream(id)
+}
+
+// hasTarget 判断上游是否包含指定地址的节点
+func hasTarget(upstream *config.Upstream, address string) bool {
+	for _, target := range upstream.AllTargets() {
+		if target.Address == address {
+			return true
+		}
+	}
+	return false
 }
 
-// extractID 从 ETCD Key 中提取 ID
+// extractID 从配置 Key 中提取 ID
 // 例: /gateway/routes/route-123 -> route-123
 func extractID(key, prefix string) string {
 	return strings.TrimPrefix(key, prefix)
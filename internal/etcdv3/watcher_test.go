@@ -0,0 +1,205 @@
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/router"
+	"github.com/RunzhiZhao/long-gate/internal/store"
+)
+
+func routeJSON(id, upstreamID string) []byte {
+	return []byte(fmt.Sprintf(`{"id": %q, "status": 1, "predicates": {"path": "/%s"}, "upstream_id": %q}`, id, id, upstreamID))
+}
+
+func upstreamJSON(id string, weight int) []byte {
+	return []byte(fmt.Sprintf(`{"id": %q, "type": "round-robin", "targets": [{"address": "10.0.0.1:80", "weight": %d}]}`, id, weight))
+}
+
+// tableState 当前路由表中的路由和上游（上游附带首个节点权重）
+func tableState(r *router.Router) string {
+	table := r.Snapshot()
+	items := make([]string, 0)
+	for _, route := range r.ListRoutes() {
+		items = append(items, "route:"+route.ID)
+	}
+	for _, id := range []string{"u1", "u2"} {
+		if upstream, ok := table.Upstream(id); ok {
+			items = append(items, fmt.Sprintf("upstream:%s:%d", id, upstream.AllTargets()[0].Weight))
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// waitState 等待路由表收敛到期望状态
+func waitState(t *testing.T, r *router.Router, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := tableState(r)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("router state = %q, want %q", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	type op func(s *store.MemoryStore)
+	put := func(key string, value []byte) op {
+		return func(s *store.MemoryStore) { s.Put(context.Background(), key, value) }
+	}
+	del := func(key string) op {
+		return func(s *store.MemoryStore) { s.Delete(context.Background(), key) }
+	}
+
+	tests := []struct {
+		name    string
+		initial []op
+		ops     []op
+		want    string
+	}{
+		{
+			name:    "initial load",
+			initial: []op{put(UpstreamPrefix+"u1", upstreamJSON("u1", 1)), put(RoutePrefix+"r1", routeJSON("r1", "u1"))},
+			want:    "route:r1,upstream:u1:1",
+		},
+		{
+			name:    "put route and upstream",
+			initial: []op{put(UpstreamPrefix+"u1", upstreamJSON("u1", 1))},
+			ops:     []op{put(UpstreamPrefix+"u2", upstreamJSON("u2", 2)), put(RoutePrefix+"r2", routeJSON("r2", "u2"))},
+			want:    "route:r2,upstream:u1:1,upstream:u2:2",
+		},
+		{
+			name:    "update upstream",
+			initial: []op{put(UpstreamPrefix+"u1", upstreamJSON("u1", 1))},
+			ops:     []op{put(UpstreamPrefix+"u1", upstreamJSON("u1", 5))},
+			want:    "upstream:u1:5",
+		},
+		{
+			name:    "delete route and upstream",
+			initial: []op{put(UpstreamPrefix+"u1", upstreamJSON("u1", 1)), put(RoutePrefix+"r1", routeJSON("r1", "u1"))},
+			ops:     []op{del(RoutePrefix + "r1"), del(UpstreamPrefix + "u1")},
+			want:    "",
+		},
+		{
+			name:    "invalid route is ignored",
+			initial: []op{put(RoutePrefix+"r1", routeJSON("r1", "u1"))},
+			ops:     []op{put(RoutePrefix+"bad", []byte(`{"id": "bad"}`)), put(RoutePrefix+"r2", routeJSON("r2", "u1"))},
+			want:    "route:r1,route:r2",
+		},
+		{
+			name:    "invalid plugin config keeps previous route",
+			initial: []op{put(RoutePrefix+"r1", routeJSON("r1", "u1"))},
+			ops: []op{
+				put(RoutePrefix+"r1", []byte(`{"id": "r1", "status": 1, "predicates": {"path": "/r1"}, "upstream_id": "u1", "plugins": {"jwt": {}}}`)),
+				put(RoutePrefix+"r2", routeJSON("r2", "u1")),
+			},
+			want: "route:r1,route:r2",
+		},
+		{
+			name: "invalid plugin config skipped on load",
+			initial: []op{
+				put(RoutePrefix+"r1", routeJSON("r1", "u1")),
+				put(RoutePrefix+"bad", []byte(`{"id": "bad", "status": 1, "predicates": {"path": "/bad"}, "upstream_id": "u1", "plugins": {"unknown": {}}}`)),
+			},
+			want: "route:r1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			for _, apply := range tt.initial {
+				apply(s)
+			}
+			r := router.NewRouter()
+			w := NewConfigWatcher(s, r, zap.NewNop())
+			if err := w.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer w.Stop()
+
+			for _, apply := range tt.ops {
+				apply(s)
+			}
+			waitState(t, r, tt.want)
+		})
+	}
+}
+
+// 监听的版本已被压缩时全量重新同步，断线期间的新增、更新和删除都能收敛
+func TestConfigWatcherResyncAfterCompaction(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	s.Put(ctx, UpstreamPrefix+"u1", upstreamJSON("u1", 1))
+	s.Put(ctx, RoutePrefix+"r1", routeJSON("r1", "u1"))
+	s.Put(ctx, RoutePrefix+"r2", routeJSON("r2", "u1"))
+
+	r := router.NewRouter()
+	w := NewConfigWatcher(s, r, zap.NewNop())
+	defer w.Stop()
+	revisions, err := w.loadAllConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.heads = revisions
+	waitState(t, r, "route:r1,route:r2,upstream:u1:1")
+
+	// 模拟断线期间的变更，并压缩掉这段历史
+	s.Delete(ctx, RoutePrefix+"r1")
+	s.Put(ctx, RoutePrefix+"r3", routeJSON("r3", "u2"))
+	s.Put(ctx, UpstreamPrefix+"u1", upstreamJSON("u1", 7))
+	s.Put(ctx, UpstreamPrefix+"u2", upstreamJSON("u2", 3))
+	_, current, _ := s.List(ctx, RoutePrefix)
+	s.Compact(current)
+
+	go w.run()
+	for _, prefix := range prefixes {
+		go w.watchPrefix(prefix, revisions[prefix])
+	}
+	waitState(t, r, "route:r2,route:r3,upstream:u1:7,upstream:u2:3")
+
+	// 重新同步后继续增量监听
+	s.Delete(ctx, RoutePrefix+"r2")
+	waitState(t, r, "route:r3,upstream:u1:7,upstream:u2:3")
+}
+
+func TestConfigWatcherDiff(t *testing.T) {
+	w := NewConfigWatcher(store.NewMemoryStore(), router.NewRouter(), zap.NewNop())
+	w.kvs = map[string]store.KeyValue{
+		RoutePrefix + "same":    {Key: RoutePrefix + "same", Revision: 1},
+		RoutePrefix + "changed": {Key: RoutePrefix + "changed", Revision: 2},
+		RoutePrefix + "gone":    {Key: RoutePrefix + "gone", Revision: 3},
+		UpstreamPrefix + "u1":   {Key: UpstreamPrefix + "u1", Revision: 4},
+	}
+	snapshot := []store.KeyValue{
+		{Key: RoutePrefix + "same", Revision: 1},
+		{Key: RoutePrefix + "changed", Revision: 5},
+		{Key: RoutePrefix + "new", Revision: 6},
+	}
+
+	got := make([]string, 0)
+	for _, event := range w.diff(RoutePrefix, snapshot) {
+		got = append(got, fmt.Sprintf("%v %s", event.Type, strings.TrimPrefix(event.Key, RoutePrefix)))
+	}
+	sort.Strings(got)
+	want := []string{
+		fmt.Sprintf("%v changed", store.EventPut),
+		fmt.Sprintf("%v gone", store.EventDelete),
+		fmt.Sprintf("%v new", store.EventPut),
+	}
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("diff = %v, want %v", got, want)
+	}
+}
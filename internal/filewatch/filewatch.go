@@ -0,0 +1,93 @@
+// Package filewatch 监听单个文件的变化
+package filewatch
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Debounce 合并文件连续写入产生的多次变更通知
+const Debounce = 200 * time.Millisecond
+
+// Watcher 文件变化监听器
+// 监听文件所在目录，以兼容编辑器和配置管理工具通过 rename 原子替换文件的写法；
+// 短时间内的连续变更合并为一次通知
+type Watcher struct {
+	path    string
+	watcher *fsnotify.Watcher
+	changes chan struct{}
+}
+
+// NewWatcher 创建文件监听器，onError 处理监听过程中的错误（可为 nil）
+func NewWatcher(path string, onError func(error)) (*Watcher, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	w := &Watcher{
+		path:    path,
+		watcher: watcher,
+		changes: make(chan struct{}, 1),
+	}
+	go w.run(onError)
+	return w, nil
+}
+
+// Changes 文件变化通知，未及时处理的多次变化合并为一次
+func (w *Watcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+// Close 停止监听
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+// run 过滤目录事件并合并连续变更，监听器关闭后退出
+func (w *Watcher) run(onError func(error)) {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.changed(event) {
+				debounce = time.After(Debounce)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			if onError != nil {
+				onError(err)
+			}
+		case <-debounce:
+			debounce = nil
+			select {
+			case w.changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// changed 判断事件是否针对被监听的文件
+func (w *Watcher) changed(event fsnotify.Event) bool {
+	if filepath.Clean(event.Name) != w.path {
+		return false
+	}
+	return event.Has(fsnotify.Write) || event.Has(fsnotify.Create) ||
+		event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove)
+}
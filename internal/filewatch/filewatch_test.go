@@ -0,0 +1,73 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	tests := []struct {
+		name   string
+		change func() error
+		notify bool
+	}{
+		{name: "write", change: func() error {
+			return os.WriteFile(path, []byte(`{"a": 1}`), 0o644)
+		}, notify: true},
+		{name: "atomic rename", change: func() error {
+			tmp := filepath.Join(dir, ".config.json.tmp")
+			if err := os.WriteFile(tmp, []byte(`{"a": 2}`), 0o644); err != nil {
+				return err
+			}
+			return os.Rename(tmp, path)
+		}, notify: true},
+		{name: "other file", change: func() error {
+			return os.WriteFile(filepath.Join(dir, "other.json"), []byte("{}"), 0o644)
+		}},
+		{name: "burst of writes", change: func() error {
+			for i := 0; i < 5; i++ {
+				if err := os.WriteFile(path, []byte{byte('0' + i)}, 0o644); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, notify: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-w.Changes():
+				if !tt.notify {
+					t.Fatal("unexpected change notification")
+				}
+			case <-time.After(4 * Debounce):
+				if tt.notify {
+					t.Fatal("no change notification")
+				}
+			}
+			// 连续变更只通知一次
+			select {
+			case <-w.Changes():
+				t.Fatal("duplicate change notification")
+			case <-time.After(2 * Debounce):
+			}
+		})
+	}
+}
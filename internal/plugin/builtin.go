@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	"errors"
+
+	"github.com/RunzhiZhao/long-gate/internal/middleware"
+)
+
+// 内置插件
+func init() {
+	Register(Plugin{
+		Name:     "jwt",
+		Priority: 2000,
+		Schema:   func() Config { return &JWTConfig{} },
+		Factory: func(cfg Config) (middleware.Middleware, error) {
+			return middleware.JWT(cfg.(*JWTConfig).Secret), nil
+		},
+	})
+}
+
+// JWTConfig JWT 鉴权插件配置
+type JWTConfig struct {
+	Secret string `json:"secret" secret:"true" desc:"HMAC 签名密钥"`
+}
+
+// Validate 校验配置
+func (c *JWTConfig) Validate() error {
+	if c.Secret == "" {
+		return errors.New("secret cannot be empty")
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+// Package plugin 路由插件注册表
+//
+// 插件以名称注册配置结构和中间件工厂，路由通过 plugins 字段按名称启用插件：
+//
+//	"plugins": {"jwt": {"secret": "my-secret"}}
+//
+// 管理 API 写入路由和加载配置文件时校验插件配置，路由发布时按优先级编译为中间件链
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/RunzhiZhao/long-gate/internal/middleware"
+)
+
+// Config 插件配置
+type Config interface {
+	// Validate 校验配置并填充默认值
+	Validate() error
+}
+
+// Plugin 插件定义
+type Plugin struct {
+	Name     string
+	Priority int                                             // 执行顺序，数字越大越先执行
+	Schema   func() Config                                   // 创建空配置（结构体指针），插件配置按 JSON 解析到其中，未知字段视为错误
+	Factory  func(cfg Config) (middleware.Middleware, error) // 根据校验后的配置创建中间件
+}
+
+// Field 插件配置字段说明，由配置结构体的标签生成：
+// 字段名取 json 标签，带 omitempty 的字段为选填，说明取 desc 标签，
+// 标注 secret:"true" 的字段为敏感字段，管理 API 返回路由时脱敏
+type Field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // JSON 类型：string/integer/number/boolean/array/object
+	Required    bool   `json:"required"`
+	Secret      bool   `json:"secret,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	plugins = make(map[string]Plugin)
+	mu      sync.RWMutex
+)
+
+// Register 注册插件，名称重复或定义不完整时 panic（需在加载路由之前调用）
+func Register(p Plugin) {
+	if p.Name == "" || p.Schema == nil || p.Factory == nil {
+		panic("plugin: name, schema and factory are required")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := plugins[p.Name]; ok {
+		panic("plugin: duplicate plugin " + p.Name)
+	}
+	plugins[p.Name] = p
+}
+
+// Get 获取插件
+func Get(name string) (Plugin, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := plugins[name]
+	return p, ok
+}
+
+// List 获取全部插件，按执行顺序排列
+func List() []Plugin {
+	mu.RLock()
+	list := make([]Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		list = append(list, p)
+	}
+	mu.RUnlock()
+
+	sortPlugins(list)
+	return list
+}
+
+// Fields 获取插件的配置字段说明
+func (p Plugin) Fields() []Field {
+	t := reflect.TypeOf(p.Schema())
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields := make([]Field, 0)
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, Field{
+			Name:        name,
+			Type:        jsonType(f.Type),
+			Required:    !strings.Contains(","+opts+",", ",omitempty,"),
+			Secret:      f.Tag.Get("secret") == "true",
+			Description: f.Tag.Get("desc"),
+		})
+	}
+	return fields
+}
+
+// Redact 返回将敏感字段替换为 placeholder 后的插件配置副本，不修改 configs
+// 未注册的插件和非对象配置原样保留
+func Redact(configs map[string]any, placeholder string) map[string]any {
+	if configs == nil {
+		return nil
+	}
+	redacted := make(map[string]any, len(configs))
+	for name, raw := range configs {
+		redacted[name] = raw
+		fields, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		copied := make(map[string]any, len(fields))
+		for key, value := range fields {
+			copied[key] = value
+		}
+		for _, secret := range secretFields(name) {
+			if value := copied[secret]; value != nil && value != "" {
+				copied[secret] = placeholder
+			}
+		}
+		redacted[name] = copied
+	}
+	return redacted
+}
+
+// Restore 将 configs 中值为 placeholder 的敏感字段恢复为 stored 中的原值（原地修改），
+// stored 中没有对应值时删除该字段，由配置校验报告缺失
+func Restore(configs, stored map[string]any, placeholder string) {
+	for name, raw := range configs {
+		fields, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		previous, _ := stored[name].(map[string]any)
+		for _, secret := range secretFields(name) {
+			if fields[secret] != placeholder {
+				continue
+			}
+			if value, ok := previous[secret]; ok {
+				fields[secret] = value
+			} else {
+				delete(fields, secret)
+			}
+		}
+	}
+}
+
+// secretFields 获取插件的敏感字段名
+func secretFields(name string) []string {
+	p, ok := Get(name)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, f := range p.Fields() {
+		if f.Secret {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// jsonType Go 类型对应的 JSON 类型名
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "any"
+}
+
+// Decode 解析并校验插件配置
+func Decode(name string, raw any) (Config, error) {
+	p, ok := Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown plugin: %s", name)
+	}
+	return p.decode(raw)
+}
+
+// decode 将路由中的原始配置按 JSON 解析到插件的配置结构
+func (p Plugin) decode(raw any) (Config, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+
+	cfg := p.Schema()
+	if raw != nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("plugin %s: invalid config: %w", p.Name, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	return cfg, nil
+}
+
+// Validate 校验路由的全部插件配置
+func Validate(configs map[string]any) error {
+	for name, raw := range configs {
+		if _, err := Decode(name, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build 将路由的插件配置编译为中间件链，按插件优先级排列
+func Build(configs map[string]any) (*middleware.Chain, error) {
+	enabled := make([]Plugin, 0, len(configs))
+	for name := range configs {
+		p, ok := Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown plugin: %s", name)
+		}
+		enabled = append(enabled, p)
+	}
+	sortPlugins(enabled)
+
+	middlewares := make([]middleware.Middleware, 0, len(enabled))
+	for _, p := range enabled {
+		cfg, err := p.decode(configs[p.Name])
+		if err != nil {
+			return nil, err
+		}
+		m, err := p.Factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+		middlewares = append(middlewares, m)
+	}
+	return middleware.NewChain(middlewares...), nil
+}
+
+// sortPlugins 按优先级从高到低排序，优先级相同时按名称排序
+func sortPlugins(list []Plugin) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority {
+			return list[i].Priority > list[j].Priority
+		}
+		return list[i].Name < list[j].Name
+	})
+}
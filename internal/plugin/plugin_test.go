@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs map[string]any
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "jwt", configs: map[string]any{"jwt": map[string]any{"secret": "s"}}},
+		{name: "unknown plugin", configs: map[string]any{"cors": map[string]any{}}, wantErr: "unknown plugin: cors"},
+		{name: "unknown field", configs: map[string]any{"jwt": map[string]any{"secret": "s", "alg": "HS256"}}, wantErr: "unknown field"},
+		{name: "missing secret", configs: map[string]any{"jwt": map[string]any{}}, wantErr: "secret cannot be empty"},
+		{name: "null config", configs: map[string]any{"jwt": nil}, wantErr: "secret cannot be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.configs)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type fieldsConfig struct {
+	Limit   int               `json:"limit" desc:"每秒请求数"`
+	Burst   *int              `json:"burst,omitempty"`
+	Ratio   float64           `json:"ratio,omitempty"`
+	Paths   []string          `json:"paths,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Enabled bool
+	Skipped string `json:"-"`
+	hidden  string
+}
+
+func (c *fieldsConfig) Validate() error { return nil }
+
+func TestFields(t *testing.T) {
+	p := Plugin{Name: "test", Schema: func() Config { return &fieldsConfig{} }}
+	want := []Field{
+		{Name: "limit", Type: "integer", Required: true, Description: "每秒请求数"},
+		{Name: "burst", Type: "integer"},
+		{Name: "ratio", Type: "number"},
+		{Name: "paths", Type: "array"},
+		{Name: "headers", Type: "object"},
+		{Name: "Enabled", Type: "boolean", Required: true},
+	}
+	if got := p.Fields(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("fields = %+v, want %+v", got, want)
+	}
+
+	jwt, ok := Get("jwt")
+	if !ok {
+		t.Fatal("jwt plugin not registered")
+	}
+	if got := jwt.Fields(); len(got) != 1 || got[0].Name != "secret" || !got[0].Required || !got[0].Secret || got[0].Description == "" {
+		t.Fatalf("jwt fields = %+v", got)
+	}
+}
+
+func TestRedactRestore(t *testing.T) {
+	const placeholder = "******"
+	configs := map[string]any{
+		"jwt":     map[string]any{"secret": "s3cret"},
+		"unknown": map[string]any{"secret": "kept"},
+	}
+
+	redacted := Redact(configs, placeholder)
+	if got := redacted["jwt"].(map[string]any)["secret"]; got != placeholder {
+		t.Fatalf("redacted jwt secret = %v, want placeholder", got)
+	}
+	if got := redacted["unknown"].(map[string]any)["secret"]; got != "kept" {
+		t.Fatalf("unregistered plugin secret = %v, want unchanged", got)
+	}
+	if got := configs["jwt"].(map[string]any)["secret"]; got != "s3cret" {
+		t.Fatalf("Redact modified the original config: %v", got)
+	}
+	if Redact(nil, placeholder) != nil {
+		t.Fatal("Redact(nil) should be nil")
+	}
+
+	tests := []struct {
+		name      string
+		submitted any
+		stored    map[string]any
+		want      map[string]any
+	}{
+		{name: "placeholder restored", submitted: placeholder, stored: configs, want: map[string]any{"secret": "s3cret"}},
+		{name: "new secret kept", submitted: "rotated", stored: configs, want: map[string]any{"secret": "rotated"}},
+		{name: "placeholder without stored secret", submitted: placeholder, want: map[string]any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submitted := map[string]any{"jwt": map[string]any{"secret": tt.submitted}}
+			Restore(submitted, tt.stored, placeholder)
+			if got := submitted["jwt"]; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("restored = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
@@ -8,61 +10,138 @@ import (
 	"sync/atomic"
 
 	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/middleware"
+	"github.com/RunzhiZhao/long-gate/internal/plugin"
 )
 
 // Router 路由引擎
 type Router struct {
 	routes atomic.Value // *RouteTable，支持原子更新
 	mu     sync.RWMutex
+
+	global *middleware.Chain // 全局中间件链
+	final  HandlerBuilder    // 路由最终处理器
 }
 
+// HandlerBuilder 构建路由的最终处理器，table 为路由所在的路由表，请求从中获取同一代配置的上游
+type HandlerBuilder func(route *config.Route, table *RouteTable) middleware.HandlerFunc
+
 // RouteTable 路由表（不可变结构）
+// 与同一代配置的上游注册表一起发布，请求从同一个快照中获取路由和上游
 type RouteTable struct {
-	routes   []*config.Route
-	indexMap map[string]*config.Route // id -> route 快速查找
+	routes    []*config.Route
+	indexMap  map[string]*config.Route    // id -> route 快速查找
+	upstreams map[string]*config.Upstream // upstream_id -> Upstream
+	plugins   map[*config.Route]*middleware.Chain
+	handlers  map[*config.Route]middleware.HandlerFunc
 }
 
 // NewRouter 创建路由引擎
 func NewRouter() *Router {
-	r := &Router{}
-	r.routes.Store(&RouteTable{
-		routes:   make([]*config.Route, 0),
-		indexMap: make(map[string]*config.Route),
-	})
+	r := &Router{
+		global: middleware.NewChain(),
+		final: func(route *config.Route, table *RouteTable) middleware.HandlerFunc {
+			return func(ctx *middleware.Context) {}
+		},
+	}
+	table, _ := r.newRouteTable(nil, nil, nil)
+	r.routes.Store(table)
 	return r
 }
 
-// LoadRoutes 加载路由表（全量替换）
-func (r *Router) LoadRoutes(routes []*config.Route) error {
-	// 验证并排序路由（按优先级降序）
-	validRoutes := make([]*config.Route, 0, len(routes))
+// SetHandler 设置全局中间件链和路由最终处理器，须在发布路由前调用
+// 构建路由表时将全局中间件、路由插件和最终处理器编译为每个路由的完整处理器
+func (r *Router) SetHandler(global *middleware.Chain, final HandlerBuilder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.global = global
+	r.final = final
+}
+
+// newRouteTable 构建路由表，路由按优先级降序排列，调用方需持有 r.mu（NewRouter 除外）
+// 路由的插件中间件链只在路由首次加载时编译，未变化的路由沿用 prev 中已编译的链；
+// 完整处理器绑定本代路由表，每次构建时重新组装，请求处理时不再分配。
+// 编译失败的路由不会被加载，其错误合并后返回
+func (r *Router) newRouteTable(routes []*config.Route, upstreams map[string]*config.Upstream, prev *RouteTable) (*RouteTable, error) {
+	table := &RouteTable{
+		routes:    make([]*config.Route, 0, len(routes)),
+		indexMap:  make(map[string]*config.Route, len(routes)),
+		upstreams: upstreams,
+		plugins:   make(map[*config.Route]*middleware.Chain, len(routes)),
+		handlers:  make(map[*config.Route]middleware.HandlerFunc, len(routes)),
+	}
+	if table.upstreams == nil {
+		table.upstreams = make(map[string]*config.Upstream)
+	}
+	var errs []error
 	for _, route := range routes {
-		if err := route.Validate(); err != nil {
-			continue // 跳过无效路由
+		chain, ok := prev.chain(route)
+		if !ok {
+			var err error
+			if chain, err = plugin.Build(route.Plugins); err != nil {
+				errs = append(errs, fmt.Errorf("route %s: %w", route.ID, err))
+				continue
+			}
 		}
-		validRoutes = append(validRoutes, route)
+		table.plugins[route] = chain
+		table.handlers[route] = r.global.Then(chain.Then(r.final(route, table)))
+		table.routes = append(table.routes, route)
+		table.indexMap[route.ID] = route
 	}
 
-	// 按优先级排序（优先级高的在前）
-	sort.Slice(validRoutes, func(i, j int) bool {
-		return validRoutes[i].Priority > validRoutes[j].Priority
+	sort.SliceStable(table.routes, func(i, j int) bool {
+		return table.routes[i].Priority > table.routes[j].Priority
 	})
+	return table, errors.Join(errs...)
+}
 
-	// 构建新的路由表
-	newTable := &RouteTable{
-		routes:   validRoutes,
-		indexMap: make(map[string]*config.Route),
-	}
-	for _, route := range validRoutes {
-		newTable.indexMap[route.ID] = route
+// chain 获取已编译的路由插件中间件链
+func (t *RouteTable) chain(route *config.Route) (*middleware.Chain, bool) {
+	if t == nil {
+		return nil, false
 	}
+	chain, ok := t.plugins[route]
+	return chain, ok
+}
 
-	// 原子替换
-	r.routes.Store(newTable)
-	return nil
+// Handler 获取路由的完整处理器：全局中间件 -> 路由插件 -> 最终处理器
+// route 须来自本路由表（如 Match 的结果）
+func (t *RouteTable) Handler(route *config.Route) middleware.HandlerFunc {
+	return t.handlers[route]
 }
 
-// AddRoute 添加单个路由（增量更新）
+// Snapshot 获取当前配置快照
+func (r *Router) Snapshot() *RouteTable {
+	return r.routes.Load().(*RouteTable)
+}
+
+// Publish 原子发布新一代路由表和上游注册表（全量替换）
+// 路由需已通过校验（配置监听器解析时完成），发布时不再修改路由对象，
+// 它们可能正被旧快照上的请求读取；调用方不能再修改传入的 upstreams
+// 插件编译失败的路由不会被发布，其余路由照常发布，错误返回给调用方记录
+func (r *Router) Publish(routes []*config.Route, upstreams map[string]*config.Upstream) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	table, err := r.newRouteTable(routes, upstreams, r.Snapshot())
+	r.routes.Store(table)
+	return err
+}
+
+// LoadRoutes 加载已校验的路由表（全量替换），上游注册表保持不变
+// 与 Publish 相同，插件编译失败的路由被跳过并返回错误
+func (r *Router) LoadRoutes(routes []*config.Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldTable := r.Snapshot()
+	table, err := r.newRouteTable(routes, oldTable.upstreams, oldTable)
+	r.routes.Store(table)
+	return err
+}
+
+// AddRoute 校验并添加单个路由（增量更新），route 须为尚未发布的新对象
+// 插件编译失败时返回错误，路由表保持不变
 func (r *Router) AddRoute(route *config.Route) error {
 	if err := route.Validate(); err != nil {
 		return err
@@ -71,7 +150,7 @@ func (r *Router) AddRoute(route *config.Route) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	oldTable := r.routes.Load().(*RouteTable)
+	oldTable := r.Snapshot()
 
 	// 创建新路由列表
 	newRoutes := make([]*config.Route, 0, len(oldTable.routes)+1)
@@ -90,21 +169,11 @@ func (r *Router) AddRoute(route *config.Route) error {
 		newRoutes = append(newRoutes, route) // 新增
 	}
 
-	// 重新排序
-	sort.Slice(newRoutes, func(i, j int) bool {
-		return newRoutes[i].Priority > newRoutes[j].Priority
-	})
-
-	// 构建新表
-	newTable := &RouteTable{
-		routes:   newRoutes,
-		indexMap: make(map[string]*config.Route),
-	}
-	for _, r := range newRoutes {
-		newTable.indexMap[r.ID] = r
+	table, err := r.newRouteTable(newRoutes, oldTable.upstreams, oldTable)
+	if err != nil {
+		return err
 	}
-
-	r.routes.Store(newTable)
+	r.routes.Store(table)
 	return nil
 }
 
@@ -113,7 +182,7 @@ func (r *Router) DeleteRoute(routeID string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	oldTable := r.routes.Load().(*RouteTable)
+	oldTable := r.Snapshot()
 
 	newRoutes := make([]*config.Route, 0, len(oldTable.routes))
 	for _, route := range oldTable.routes {
@@ -122,29 +191,55 @@ func (r *Router) DeleteRoute(routeID string) error {
 		}
 	}
 
-	newTable := &RouteTable{
-		routes:   newRoutes,
-		indexMap: make(map[string]*config.Route),
-	}
-	for _, r := range newRoutes {
-		newTable.indexMap[r.ID] = r
-	}
-
-	r.routes.Store(newTable)
+	// 保留的路由均已编译，不会产生错误
+	table, _ := r.newRouteTable(newRoutes, oldTable.upstreams, oldTable)
+	r.routes.Store(table)
 	return nil
 }
 
 // Match 匹配路由
 func (r *Router) Match(req *http.Request) (*config.Route, map[string]string) {
-	table := r.routes.Load().(*RouteTable)
+	return r.Snapshot().Match(req)
+}
+
+// GetRoute 根据 ID 获取路由
+func (r *Router) GetRoute(id string) *config.Route {
+	return r.Snapshot().indexMap[id]
+}
 
+// ListRoutes 获取所有路由
+func (r *Router) ListRoutes() []*config.Route {
+	table := r.Snapshot()
+	routes := make([]*config.Route, len(table.routes))
+	copy(routes, table.routes)
+	return routes
+}
+
+// GetUpstream 根据 ID 获取当前快照中的上游
+func (r *Router) GetUpstream(id string) (*config.Upstream, bool) {
+	return r.Snapshot().Upstream(id)
+}
+
+// ListUpstreams 获取当前快照中的全部上游，按 ID 排序
+func (r *Router) ListUpstreams() []*config.Upstream {
+	table := r.Snapshot()
+	upstreams := make([]*config.Upstream, 0, len(table.upstreams))
+	for _, upstream := range table.upstreams {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Slice(upstreams, func(i, j int) bool { return upstreams[i].ID < upstreams[j].ID })
+	return upstreams
+}
+
+// Match 在快照中匹配路由
+func (t *RouteTable) Match(req *http.Request) (*config.Route, map[string]string) {
 	path := req.URL.Path
 	method := req.Method
 	host := req.Host
 	headers := extractHeaders(req)
 
 	// 按优先级顺序匹配
-	for _, route := range table.routes {
+	for _, route := range t.routes {
 		if route.Match(path, method, host, headers) {
 			// 提取路径参数（如果是参数化路由）
 			params := extractPathParams(route.Predicates.Path, path)
@@ -155,18 +250,10 @@ func (r *Router) Match(req *http.Request) (*config.Route, map[string]string) {
 	return nil, nil
 }
 
-// GetRoute 根据 ID 获取路由
-func (r *Router) GetRoute(id string) *config.Route {
-	table := r.routes.Load().(*RouteTable)
-	return table.indexMap[id]
-}
-
-// ListRoutes 获取所有路由
-func (r *Router) ListRoutes() []*config.Route {
-	table := r.routes.Load().(*RouteTable)
-	routes := make([]*config.Route, len(table.routes))
-	copy(routes, table.routes)
-	return routes
+// Upstream 获取快照中的上游
+func (t *RouteTable) Upstream(id string) (*config.Upstream, bool) {
+	upstream, ok := t.upstreams[id]
+	return upstream, ok
 }
 
 // extractHeaders 提取 HTTP 头部
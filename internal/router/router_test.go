@@ -0,0 +1,147 @@
+package router
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/middleware"
+)
+
+func newRoute(t *testing.T, id, path string, pathType config.PathType, priority int) *config.Route {
+	t.Helper()
+	route := &config.Route{
+		ID:         id,
+		Priority:   priority,
+		Status:     config.RouteStatusEnabled,
+		Predicates: &config.RoutePredicates{Path: path, PathType: pathType},
+		UpstreamID: "u1",
+	}
+	if err := route.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return route
+}
+
+func TestMatch(t *testing.T) {
+	r := NewRouter()
+	r.Publish([]*config.Route{
+		newRoute(t, "prefix", "/api", config.PathTypePrefix, 0),
+		newRoute(t, "exact", "/api/health", config.PathTypeExact, 10),
+		newRoute(t, "regex", `^/api/v[0-9]+/users$`, config.PathTypeRegex, 5),
+	}, nil)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/api/health", want: "exact"},
+		{path: "/api/v2/users", want: "regex"},
+		{path: "/api/orders", want: "prefix"},
+		{path: "/other", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			route, _ := r.Match(httptest.NewRequest("GET", tt.path, nil))
+			got := ""
+			if route != nil {
+				got = route.ID
+			}
+			if got != tt.want {
+				t.Fatalf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 重新发布同一批路由时不修改路由对象，与并发匹配没有数据竞争
+func TestPublishDoesNotMutateLiveRoutes(t *testing.T) {
+	r := NewRouter()
+	routes := []*config.Route{newRoute(t, "regex", `^/api/v[0-9]+$`, config.PathTypeRegex, 0)}
+	r.Publish(routes, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2000; i++ {
+			r.Publish(routes, nil)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2000; i++ {
+			if route, _ := r.Match(httptest.NewRequest("GET", "/api/v1", nil)); route == nil {
+				t.Error("route not matched")
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestPluginBuildErrors(t *testing.T) {
+	good := newRoute(t, "good", "/good", config.PathTypePrefix, 0)
+	bad := newRoute(t, "bad", "/bad", config.PathTypePrefix, 0)
+	bad.Plugins = map[string]any{"jwt": map[string]any{}}
+
+	r := NewRouter()
+	err := r.Publish([]*config.Route{good, bad}, nil)
+	if err == nil || !strings.Contains(err.Error(), "route bad") {
+		t.Fatalf("Publish error = %v, want build error for route bad", err)
+	}
+	if r.GetRoute("good") == nil || r.GetRoute("bad") != nil {
+		t.Fatal("Publish should load the good route and skip the bad one")
+	}
+
+	invalid := newRoute(t, "good", "/good", config.PathTypePrefix, 0)
+	invalid.Plugins = map[string]any{"unknown": nil}
+	if err := r.AddRoute(invalid); err == nil {
+		t.Fatal("AddRoute should return the plugin build error")
+	}
+	if r.GetRoute("good") != good {
+		t.Fatal("failed AddRoute must leave the route table unchanged")
+	}
+}
+
+func TestRouteHandler(t *testing.T) {
+	var globalCalls int
+	var served *config.Upstream
+	r := NewRouter()
+	r.SetHandler(middleware.NewChain(func(next middleware.HandlerFunc) middleware.HandlerFunc {
+		return func(ctx *middleware.Context) {
+			globalCalls++
+			next(ctx)
+		}
+	}), func(route *config.Route, table *RouteTable) middleware.HandlerFunc {
+		return func(ctx *middleware.Context) {
+			served, _ = table.Upstream(route.UpstreamID)
+		}
+	})
+
+	route := newRoute(t, "r1", "/api", config.PathTypePrefix, 0)
+	req := httptest.NewRequest("GET", "/api", nil)
+	ctx := middleware.NewContext(httptest.NewRecorder(), req, zap.NewNop())
+
+	// 处理器绑定发布时的上游注册表，重新发布后使用新一代上游
+	for i := 1; i <= 2; i++ {
+		upstream := &config.Upstream{ID: "u1"}
+		r.Publish([]*config.Route{route}, map[string]*config.Upstream{"u1": upstream})
+		table := r.Snapshot()
+		matched, _ := table.Match(req)
+		table.Handler(matched)(ctx)
+		if globalCalls != i || served != upstream {
+			t.Fatalf("publish %d: global calls = %d, served current upstream = %v", i, globalCalls, served == upstream)
+		}
+	}
+
+	// 处理器在加载路由时编译，请求处理时不再分配
+	table := r.Snapshot()
+	if allocs := testing.AllocsPerRun(100, func() { table.Handler(route)(ctx) }); allocs != 0 {
+		t.Fatalf("allocs per request = %v, want 0", allocs)
+	}
+}
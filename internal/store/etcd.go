@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EtcdStore 基于 ETCD 的配置存储
+type EtcdStore struct {
+	client *clientv3.Client
+}
+
+// NewEtcdStore 创建 ETCD 配置存储
+func NewEtcdStore(client *clientv3.Client) *EtcdStore {
+	return &EtcdStore{client: client}
+}
+
+// List 获取前缀下的全部配置项
+func (s *EtcdStore) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	kvs := make([]KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, KeyValue{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision})
+	}
+	return kvs, resp.Header.Revision, nil
+}
+
+// Get 获取配置项
+func (s *EtcdStore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+	kv := resp.Kvs[0]
+	return &KeyValue{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision}, nil
+}
+
+// Put 写入配置项
+func (s *EtcdStore) Put(ctx context.Context, key string, value []byte) (int64, error) {
+	resp, err := s.client.Put(ctx, key, string(value))
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.Revision, nil
+}
+
+// CompareAndPut 基于 ModRevision 的乐观锁写入
+func (s *EtcdStore) CompareAndPut(ctx context.Context, key string, value []byte, revision int64) (int64, error) {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", revision)).
+		Then(clientv3.OpPut(key, string(value))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, ErrConflict
+	}
+	return resp.Header.Revision, nil
+}
+
+// Delete 删除配置项
+func (s *EtcdStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Delete(ctx, key)
+	return err
+}
+
+// Watch 监听前缀下的变更
+func (s *EtcdStore) Watch(ctx context.Context, prefix string, revision int64) <-chan WatchResponse {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+
+	out := make(chan WatchResponse)
+	go func() {
+		defer close(out)
+
+		for resp := range s.client.Watch(ctx, prefix, opts...) {
+			wr := WatchResponse{Revision: resp.Header.Revision}
+			if err := resp.Err(); err != nil {
+				wr.Err = err
+				if resp.CompactRevision != 0 {
+					wr.Err = fmt.Errorf("%w: compact revision %d", ErrCompacted, resp.CompactRevision)
+				}
+			}
+			for _, ev := range resp.Events {
+				event := Event{Key: string(ev.Kv.Key), Value: ev.Kv.Value, Revision: ev.Kv.ModRevision}
+				if ev.Type == clientv3.EventTypeDelete {
+					event.Type = EventDelete
+				}
+				wr.Events = append(wr.Events, event)
+			}
+
+			select {
+			case out <- wr:
+			case <-ctx.Done():
+				return
+			}
+			if wr.Err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"github.com/RunzhiZhao/long-gate/internal/filewatch"
+	"github.com/RunzhiZhao/long-gate/internal/plugin"
+)
+
+// FileStore 基于本地 YAML/JSON 文件的只读配置存储（单机模式）
+// 文件变化时整体重新加载，变化的配置项以同一个版本发布；校验失败则保留当前配置
+type FileStore struct {
+	memory *MemoryStore
+	path   string
+	logger *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// fileConfig 配置文件结构，字段格式与管理 API 一致
+type fileConfig struct {
+	Routes    []json.RawMessage `json:"routes"`
+	Upstreams []json.RawMessage `json:"upstreams"`
+}
+
+// NewFileStore 创建文件配置存储
+func NewFileStore(path string, logger *zap.Logger) *FileStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &FileStore{
+		memory: NewMemoryStore(),
+		path:   path,
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start 加载配置文件并监听变化
+func (s *FileStore) Start() error {
+	path, err := filepath.Abs(s.path)
+	if err != nil {
+		return err
+	}
+	s.path = path
+
+	if err := s.reload(); err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
+	}
+
+	watcher, err := filewatch.NewWatcher(s.path, func(err error) {
+		s.logger.Warn("config file watch error", zap.Error(err))
+	})
+	if err != nil {
+		return err
+	}
+	go s.watchFile(watcher)
+
+	s.logger.Info("file config store started", zap.String("path", s.path))
+	return nil
+}
+
+// Stop 停止监听
+func (s *FileStore) Stop() {
+	s.cancel()
+	s.logger.Info("file config store stopped")
+}
+
+// List 获取前缀下的全部配置项
+func (s *FileStore) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	return s.memory.List(ctx, prefix)
+}
+
+// Get 获取配置项
+func (s *FileStore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	return s.memory.Get(ctx, key)
+}
+
+// Watch 监听前缀下的变更
+func (s *FileStore) Watch(ctx context.Context, prefix string, revision int64) <-chan WatchResponse {
+	return s.memory.Watch(ctx, prefix, revision)
+}
+
+// Put 文件存储不支持写入
+func (s *FileStore) Put(ctx context.Context, key string, value []byte) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+// CompareAndPut 文件存储不支持写入
+func (s *FileStore) CompareAndPut(ctx context.Context, key string, value []byte, revision int64) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+// Delete 文件存储不支持写入
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	return ErrReadOnly
+}
+
+// watchFile 监听配置文件变化并重新加载
+func (s *FileStore) watchFile(watcher *filewatch.Watcher) {
+	defer watcher.Close()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-watcher.Changes():
+			if err := s.reload(); err != nil {
+				s.logger.Error("config reload rejected, keeping current config",
+					zap.String("path", s.path),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// reload 读取配置文件，将与当前内容的差异作为一批变更发布
+func (s *FileStore) reload() error {
+	data, err := loadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+
+	events := make([]Event, 0)
+	for key, value := range data {
+		if kv, ok := s.memory.data[key]; !ok || !bytes.Equal(kv.Value, value) {
+			events = append(events, Event{Type: EventPut, Key: key, Value: value})
+		}
+	}
+	for key := range s.memory.data {
+		if _, ok := data[key]; !ok {
+			events = append(events, Event{Type: EventDelete, Key: key})
+		}
+	}
+	revision := s.memory.apply(events)
+
+	s.logger.Info("loaded config file",
+		zap.String("path", s.path),
+		zap.Int("changes", len(events)),
+		zap.Int64("revision", revision))
+	return nil
+}
+
+// loadFile 读取并校验配置文件，返回 Key 到配置 JSON 的映射
+// 任一路由或上游非法时整个文件视为无效
+func loadFile(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML 先转换为 JSON，复用配置结构的 JSON 解析和校验
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parse yaml: %w", err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("convert yaml: %w", err)
+		}
+	}
+
+	var cfg fileConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	kvs := make(map[string][]byte, len(cfg.Routes)+len(cfg.Upstreams))
+	for _, item := range cfg.Upstreams {
+		upstream := &config.Upstream{}
+		if err := upstream.FromJSON(item); err != nil {
+			return nil, fmt.Errorf("invalid upstream %s: %w", upstream.ID, err)
+		}
+		if upstream.Discovery != nil && upstream.Discovery.Type == config.DiscoveryEtcd {
+			return nil, fmt.Errorf("upstream %s: etcd discovery is not available with file config", upstream.ID)
+		}
+		key := UpstreamPrefix + upstream.ID
+		if _, ok := kvs[key]; ok {
+			return nil, fmt.Errorf("duplicate upstream id: %s", upstream.ID)
+		}
+		kvs[key] = item
+	}
+
+	for _, item := range cfg.Routes {
+		route := &config.Route{}
+		if err := route.FromJSON(item); err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.ID, err)
+		}
+		if err := plugin.Validate(route.Plugins); err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.ID, err)
+		}
+		key := RoutePrefix + route.ID
+		if _, ok := kvs[key]; ok {
+			return nil, fmt.Errorf("duplicate route id: %s", route.ID)
+		}
+
+		upstreamIDs := []string{route.UpstreamID}
+		if route.Fallback != nil {
+			upstreamIDs = append(upstreamIDs, route.Fallback.UpstreamIDs...)
+		}
+		for _, id := range upstreamIDs {
+			if _, ok := kvs[UpstreamPrefix+id]; !ok {
+				return nil, fmt.Errorf("route %s references unknown upstream %s", route.ID, id)
+			}
+		}
+		kvs[key] = item
+	}
+	return kvs, nil
+}
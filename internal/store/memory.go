@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore 内存配置存储，保留全部变更历史，用于测试和单机模式
+type MemoryStore struct {
+	data      map[string]KeyValue
+	history   []Event // 按版本递增，已写入的事件不再修改
+	revision  int64
+	compacted int64 // 已压缩的版本，不晚于该版本的历史不可再监听
+	watchers  map[chan struct{}]struct{}
+	mu        sync.Mutex
+}
+
+// NewMemoryStore 创建内存配置存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data:     make(map[string]KeyValue),
+		watchers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// List 获取前缀下的全部配置项
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kvs := make([]KeyValue, 0)
+	for key, kv := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, kv)
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, s.revision, nil
+}
+
+// Get 获取配置项
+func (s *MemoryStore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kv, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &kv, nil
+}
+
+// Put 写入配置项
+func (s *MemoryStore) Put(ctx context.Context, key string, value []byte) (int64, error) {
+	return s.Apply([]Event{{Type: EventPut, Key: key, Value: value}}), nil
+}
+
+// CompareAndPut 配置项当前版本等于 revision 时写入
+func (s *MemoryStore) CompareAndPut(ctx context.Context, key string, value []byte, revision int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data[key].Revision != revision {
+		return 0, ErrConflict
+	}
+	return s.apply([]Event{{Type: EventPut, Key: key, Value: value}}), nil
+}
+
+// Delete 删除配置项
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.Apply([]Event{{Type: EventDelete, Key: key}})
+	return nil
+}
+
+// Apply 以同一个版本原子应用一批变更，返回新的存储版本
+func (s *MemoryStore) Apply(events []Event) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.apply(events)
+}
+
+// apply 应用一批变更并通知监听者（调用方需持有锁）
+// 删除不存在的 Key 不产生事件
+func (s *MemoryStore) apply(events []Event) int64 {
+	revision := s.revision + 1
+	applied := false
+	for _, event := range events {
+		event.Revision = revision
+		switch event.Type {
+		case EventPut:
+			s.data[event.Key] = KeyValue{Key: event.Key, Value: event.Value, Revision: revision}
+		case EventDelete:
+			if _, ok := s.data[event.Key]; !ok {
+				continue
+			}
+			delete(s.data, event.Key)
+		}
+		s.history = append(s.history, event)
+		applied = true
+	}
+	if !applied {
+		return s.revision
+	}
+
+	s.revision = revision
+	for notify := range s.watchers {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+	return revision
+}
+
+// Watch 监听前缀下的变更
+func (s *MemoryStore) Watch(ctx context.Context, prefix string, revision int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	notify := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	if revision > 0 && revision <= s.compacted {
+		err := fmt.Errorf("%w: compact revision %d", ErrCompacted, s.compacted)
+		s.mu.Unlock()
+		go func() {
+			defer close(out)
+			select {
+			case out <- WatchResponse{Revision: revision, Err: err}:
+			case <-ctx.Done():
+			}
+		}()
+		return out
+	}
+	next := s.revision + 1 // 下一个待发送的版本
+	if revision > 0 {
+		next = revision
+		notify <- struct{}{} // 先回放历史
+	}
+	s.watchers[notify] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		defer close(out)
+		defer func() {
+			s.mu.Lock()
+			delete(s.watchers, notify)
+			s.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-notify:
+			}
+
+			s.mu.Lock()
+			events := s.history[sort.Search(len(s.history), func(i int) bool {
+				return s.history[i].Revision >= next
+			}):]
+			next = s.revision + 1
+			s.mu.Unlock()
+
+			for _, resp := range groupEvents(events, prefix) {
+				select {
+				case out <- resp:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Compact 丢弃不晚于 revision 的变更历史，之后从这些版本开始的监听返回 ErrCompacted
+func (s *MemoryStore) Compact(revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if revision > s.revision {
+		revision = s.revision
+	}
+	if revision <= s.compacted {
+		return
+	}
+	i := sort.Search(len(s.history), func(i int) bool {
+		return s.history[i].Revision > revision
+	})
+	s.history = append([]Event(nil), s.history[i:]...)
+	s.compacted = revision
+}
+
+// groupEvents 过滤前缀并按版本分组
+func groupEvents(events []Event, prefix string) []WatchResponse {
+	responses := make([]WatchResponse, 0)
+	for _, event := range events {
+		if !strings.HasPrefix(event.Key, prefix) {
+			continue
+		}
+		if n := len(responses); n > 0 && responses[n-1].Revision == event.Revision {
+			responses[n-1].Events = append(responses[n-1].Events, event)
+			continue
+		}
+		responses = append(responses, WatchResponse{Revision: event.Revision, Events: []Event{event}})
+	}
+	return responses
+}
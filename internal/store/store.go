@@ -0,0 +1,75 @@
+// Package store 配置存储抽象
+//
+// 配置监听器和管理 API 通过 ConfigStore 读写路由和上游配置，
+// 提供 ETCD、本地文件（只读）和内存三种实现
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// 配置 Key 前缀
+	RoutePrefix    = "/gateway/routes/"
+	UpstreamPrefix = "/gateway/upstreams/"
+)
+
+var (
+	ErrNotFound  = errors.New("key not found")
+	ErrConflict  = errors.New("revision conflict")
+	ErrReadOnly  = errors.New("config store is read-only")
+	ErrCompacted = errors.New("revision has been compacted")
+)
+
+// KeyValue 配置项
+type KeyValue struct {
+	Key      string
+	Value    []byte
+	Revision int64 // 最后一次修改时的存储版本
+}
+
+// EventType 变更类型
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+// Event 配置变更事件
+type Event struct {
+	Type     EventType
+	Key      string
+	Value    []byte // 删除事件为空
+	Revision int64
+}
+
+// WatchResponse 一批变更事件，同一批事件属于同一个存储版本
+type WatchResponse struct {
+	Revision int64
+	Events   []Event
+	Err      error // 不为空时通道随后关闭
+}
+
+// ConfigStore 配置存储
+type ConfigStore interface {
+	// List 获取前缀下的全部配置项，同时返回当前存储版本
+	List(ctx context.Context, prefix string) ([]KeyValue, int64, error)
+
+	// Get 获取配置项，不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (*KeyValue, error)
+
+	// Put 写入配置项，返回新的存储版本
+	Put(ctx context.Context, key string, value []byte) (int64, error)
+
+	// CompareAndPut 配置项当前版本等于 revision 时写入，否则返回 ErrConflict
+	CompareAndPut(ctx context.Context, key string, value []byte, revision int64) (int64, error)
+
+	// Delete 删除配置项
+	Delete(ctx context.Context, key string) error
+
+	// Watch 监听前缀下的变更，revision > 0 时从该版本（含）开始
+	// ctx 取消或出错后关闭通道，出错时最后一个响应携带 Err
+	Watch(ctx context.Context, prefix string, revision int64) <-chan WatchResponse
+}
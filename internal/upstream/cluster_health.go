@@ -0,0 +1,353 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+const (
+	// HealthPrefix 集群共享健康状态前缀
+	HealthPrefix = "/gateway/health/"
+	// 选举前缀，候选 Key 绑定各节点的会话租约
+	healthElectionPrefix = HealthPrefix + "leader"
+	// 节点状态前缀，完整 Key 为 healthStatusPrefix + upstream_id + "/" + address，两段均经过路径转义
+	healthStatusPrefix = HealthPrefix + "status/"
+)
+
+const (
+	// healthSessionTTL leader 会话租约时长，leader 失联后最迟在该时间后重新选举
+	healthSessionTTL = 10
+	// leaderCheckInterval 检查当前 leader 的间隔
+	leaderCheckInterval = 2 * time.Second
+)
+
+// SharedStatus leader 发布的节点健康状态
+type SharedStatus struct {
+	Status    config.TargetStatus `json:"status"`
+	Leader    string              `json:"leader"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// ClusterHealth 集群共享健康检查
+// 各网关节点通过 ETCD 选举出 leader，仅 leader 执行主动探测并将节点状态变化发布到 HealthPrefix，
+// 其他节点监听该前缀并应用；没有 leader 或与 ETCD 失联时回退为本地探测
+type ClusterHealth struct {
+	client  *clientv3.Client
+	checker *HealthChecker
+	node    string // 本节点标识，作为选举值
+
+	lease    clientv3.LeaseID // 当前 leader 会话租约，非 leader 时为 0
+	follower bool             // 是否正在跟随其他 leader
+	mu       sync.Mutex
+
+	logger *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewClusterHealth 创建集群共享健康检查
+func NewClusterHealth(client *clientv3.Client, checker *HealthChecker, node string, logger *zap.Logger) *ClusterHealth {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := &ClusterHealth{
+		client:  client,
+		checker: checker,
+		node:    node,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	checker.OnStatusChange(ch.publish)
+	return ch
+}
+
+// Start 参与选举并同步 leader 发布的健康状态
+func (ch *ClusterHealth) Start() {
+	go ch.campaign()
+	go ch.followLeader()
+	go ch.watchStatuses()
+	ch.logger.Info("cluster health started", zap.String("node", ch.node))
+}
+
+// Stop 停止并放弃 leader 身份
+func (ch *ClusterHealth) Stop() {
+	ch.cancel()
+	ch.logger.Info("cluster health stopped")
+}
+
+// campaign 持续参与选举，当选后保持 leader 身份直到会话失效
+func (ch *ClusterHealth) campaign() {
+	backoff := time.Second
+	for {
+		err := ch.campaignOnce()
+		if ch.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			ch.logger.Warn("health leader election failed, retrying",
+				zap.Duration("backoff", backoff),
+				zap.Error(err))
+		}
+		select {
+		case <-ch.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, healthSessionTTL*time.Second)
+	}
+}
+
+// campaignOnce 创建会话并竞选，当选后阻塞到会话失效
+func (ch *ClusterHealth) campaignOnce() error {
+	session, err := concurrency.NewSession(ch.client,
+		concurrency.WithTTL(healthSessionTTL),
+		concurrency.WithContext(ch.ctx))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// 会话失效时放弃竞选
+	ctx, cancel := context.WithCancel(ch.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	election := concurrency.NewElection(session, healthElectionPrefix)
+	if err := election.Campaign(ctx, ch.node); err != nil {
+		return err
+	}
+
+	ch.lead(session.Lease())
+	<-ctx.Done()
+	ch.lead(0)
+
+	if ch.ctx.Err() != nil {
+		// 正常退出时主动让位，其他节点无需等待租约过期
+		resignCtx, resignCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		election.Resign(resignCtx)
+		resignCancel()
+	}
+	return nil
+}
+
+// lead 切换 leader 身份，当选后开始本地探测并发布全部节点的当前状态
+func (ch *ClusterHealth) lead(lease clientv3.LeaseID) {
+	ch.mu.Lock()
+	ch.lease = lease
+	if lease != 0 {
+		ch.follower = false
+	}
+	ch.mu.Unlock()
+
+	if lease == 0 {
+		ch.logger.Warn("lost health leadership", zap.String("node", ch.node))
+		return
+	}
+	ch.checker.SetProbing(true)
+	ch.logger.Info("became health leader", zap.String("node", ch.node))
+
+	for upstreamID, targets := range ch.checker.Statuses() {
+		for address, status := range targets {
+			ch.publish(upstreamID, address, status)
+		}
+	}
+}
+
+// publish leader 发布节点健康状态，Key 绑定会话租约，leader 失效后自动清除
+func (ch *ClusterHealth) publish(upstreamID, address string, status config.TargetStatus) {
+	ch.mu.Lock()
+	lease := ch.lease
+	ch.mu.Unlock()
+	if lease == 0 {
+		return
+	}
+
+	data, err := json.Marshal(SharedStatus{Status: status, Leader: ch.node, UpdatedAt: time.Now()})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ch.ctx, 5*time.Second)
+	defer cancel()
+	if _, err := ch.client.Put(ctx, statusKey(upstreamID, address), string(data), clientv3.WithLease(lease)); err != nil {
+		ch.logger.Warn("failed to publish target health",
+			zap.String("upstream", upstreamID),
+			zap.String("target", address),
+			zap.Error(err))
+	}
+}
+
+// followLeader 定期检查当前 leader：存在其他 leader 时暂停本地探测并跟随，
+// 没有 leader 或无法访问 ETCD 时回退为本地探测
+func (ch *ClusterHealth) followLeader() {
+	ticker := time.NewTicker(leaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ch.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		leader, err := ch.leader()
+		ch.mu.Lock()
+		if ch.lease != 0 {
+			ch.mu.Unlock()
+			continue
+		}
+		follow := err == nil && leader != "" && leader != ch.node
+		changed := follow != ch.follower
+		ch.follower = follow
+		ch.mu.Unlock()
+
+		if !changed {
+			continue
+		}
+		ch.checker.SetProbing(!follow)
+		if follow {
+			ch.logger.Info("following health leader", zap.String("leader", leader))
+			ch.resync()
+		} else {
+			ch.logger.Warn("no health leader available, falling back to local checks", zap.Error(err))
+		}
+	}
+}
+
+// leader 获取当前 leader 标识，没有 leader 时返回空
+func (ch *ClusterHealth) leader() (string, error) {
+	ctx, cancel := context.WithTimeout(ch.ctx, leaderCheckInterval)
+	defer cancel()
+
+	resp, err := ch.client.Get(ctx, healthElectionPrefix+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// watchStatuses 监听 leader 发布的节点状态
+func (ch *ClusterHealth) watchStatuses() {
+	backoff := time.Second
+	for {
+		revision, err := ch.resyncRevision()
+		if err == nil {
+			backoff = time.Second
+			for resp := range ch.client.Watch(ch.ctx, healthStatusPrefix, clientv3.WithPrefix(), clientv3.WithRev(revision+1)) {
+				if err = resp.Err(); err != nil {
+					break
+				}
+				for _, ev := range resp.Events {
+					// leader 失效导致的删除不改变节点状态，由新 leader 重新发布
+					if ev.Type == clientv3.EventTypePut {
+						ch.apply(string(ev.Kv.Key), ev.Kv.Value)
+					}
+				}
+			}
+		}
+		if ch.ctx.Err() != nil {
+			return
+		}
+
+		ch.logger.Warn("health status watch error, retrying",
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		select {
+		case <-ch.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, healthSessionTTL*time.Second)
+	}
+}
+
+// resync 全量读取并应用已发布的节点状态
+func (ch *ClusterHealth) resync() {
+	if _, err := ch.resyncRevision(); err != nil {
+		ch.logger.Warn("failed to load shared health statuses", zap.Error(err))
+	}
+}
+
+// resyncRevision 全量读取并应用已发布的节点状态，返回读取时的存储版本
+func (ch *ClusterHealth) resyncRevision() (int64, error) {
+	ctx, cancel := context.WithTimeout(ch.ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := ch.client.Get(ctx, healthStatusPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	for _, kv := range resp.Kvs {
+		ch.apply(string(kv.Key), kv.Value)
+	}
+	return resp.Header.Revision, nil
+}
+
+// apply 跟随 leader 时应用发布的节点状态，本地探测期间忽略
+func (ch *ClusterHealth) apply(key string, value []byte) {
+	ch.mu.Lock()
+	follower := ch.follower
+	ch.mu.Unlock()
+	if !follower {
+		return
+	}
+
+	upstreamID, address, ok := parseStatusKey(key)
+	if !ok {
+		ch.logger.Warn("invalid shared health status key", zap.String("key", key))
+		return
+	}
+	var shared SharedStatus
+	if err := json.Unmarshal(value, &shared); err != nil {
+		ch.logger.Warn("failed to parse shared health status",
+			zap.String("key", key),
+			zap.Error(err))
+		return
+	}
+	if ch.checker.ApplyStatus(upstreamID, address, shared.Status) {
+		ch.logger.Info("applied shared target health",
+			zap.String("upstream", upstreamID),
+			zap.String("target", address),
+			zap.String("status", string(shared.Status)),
+			zap.String("leader", shared.Leader))
+	}
+}
+
+// statusKey 生成节点状态 Key，上游 ID 和节点地址中可能包含 "/"，需转义
+func statusKey(upstreamID, address string) string {
+	return healthStatusPrefix + url.PathEscape(upstreamID) + "/" + url.PathEscape(address)
+}
+
+// parseStatusKey 从节点状态 Key 中解析上游 ID 和节点地址
+func parseStatusKey(key string) (string, string, bool) {
+	rawID, rawAddress, ok := strings.Cut(strings.TrimPrefix(key, healthStatusPrefix), "/")
+	if !ok {
+		return "", "", false
+	}
+	upstreamID, err := url.PathUnescape(rawID)
+	if err != nil {
+		return "", "", false
+	}
+	address, err := url.PathUnescape(rawAddress)
+	if err != nil {
+		return "", "", false
+	}
+	return upstreamID, address, true
+}
@@ -0,0 +1,42 @@
+package upstream
+
+import "testing"
+
+func TestStatusKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		upstreamID string
+		address    string
+		key        string
+	}{
+		{name: "plain", upstreamID: "user-service", address: "10.0.0.1:8080", key: healthStatusPrefix + "user-service/10.0.0.1:8080"},
+		{name: "slash in upstream id", upstreamID: "team/user-service", address: "10.0.0.1:8080", key: healthStatusPrefix + "team%2Fuser-service/10.0.0.1:8080"},
+		{name: "slash in address", upstreamID: "unix", address: "/var/run/app.sock", key: healthStatusPrefix + "unix/%2Fvar%2Frun%2Fapp.sock"},
+		{name: "percent in upstream id", upstreamID: "a%2Fb", address: "[::1]:80", key: healthStatusPrefix + "a%252Fb/%5B::1%5D:80"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := statusKey(tt.upstreamID, tt.address)
+			if key != tt.key {
+				t.Fatalf("statusKey = %q, want %q", key, tt.key)
+			}
+			upstreamID, address, ok := parseStatusKey(key)
+			if !ok || upstreamID != tt.upstreamID || address != tt.address {
+				t.Fatalf("parseStatusKey(%q) = %q, %q, %v", key, upstreamID, address, ok)
+			}
+		})
+	}
+}
+
+func TestParseStatusKeyInvalid(t *testing.T) {
+	for _, key := range []string{
+		healthStatusPrefix + "no-address",
+		healthStatusPrefix + "bad%zz/10.0.0.1:80",
+		healthStatusPrefix + "u1/bad%zz",
+	} {
+		if _, _, ok := parseStatusKey(key); ok {
+			t.Errorf("parseStatusKey(%q) should fail", key)
+		}
+	}
+}
@@ -3,8 +3,9 @@ package upstream
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,29 +13,89 @@ import (
 	"github.com/RunzhiZhao/long-gate/internal/config"
 )
 
+// healthCheckJitter 探测间隔的随机抖动比例，错开各上游的探测时间，避免同时压向后端
+const healthCheckJitter = 0.1
+
 // HealthChecker 健康检查器
+// 由配置监听器的上游变更事件驱动，每个启用主动检查的上游按自己的 Interval 独立调度
 type HealthChecker struct {
-	upstreams map[string]*config.Upstream
-	logger    *zap.Logger
-	ctx       context.Context
-	cancel    context.CancelFunc
-	mu        sync.RWMutex
+	checks   map[string]*upstreamCheck // upstream_id -> 探测任务
+	started  bool
+	probing  atomic.Bool                                                  // 是否执行本地探测，集群共享模式下仅 leader 探测
+	onChange func(upstreamID, address string, status config.TargetStatus) // 节点健康状态变化回调
+	logger   *zap.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mu       sync.RWMutex
+}
+
+// upstreamCheck 单个上游的探测任务
+type upstreamCheck struct {
+	upstream *config.Upstream // 配置更新时原地替换，受 HealthChecker.mu 保护
+	interval time.Duration
+	cancel   context.CancelFunc
+	unknown  chan struct{} // 配置更新带来新节点时通知探测协程立即探测未知状态节点
 }
 
 // NewHealthChecker 创建健康检查器
 func NewHealthChecker(logger *zap.Logger) *HealthChecker {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &HealthChecker{
-		upstreams: make(map[string]*config.Upstream),
-		logger:    logger,
-		ctx:       ctx,
-		cancel:    cancel,
+	hc := &HealthChecker{
+		checks: make(map[string]*upstreamCheck),
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
 	}
+	hc.probing.Store(true)
+	return hc
 }
 
-// Start 启动健康检查
+// OnStatusChange 注册节点健康状态变化回调（需在 Start 之前调用）
+func (hc *HealthChecker) OnStatusChange(fn func(upstreamID, address string, status config.TargetStatus)) {
+	hc.onChange = fn
+}
+
+// SetProbing 启用或暂停本地探测，暂停期间节点状态由 ApplyStatus 从外部同步
+func (hc *HealthChecker) SetProbing(enabled bool) {
+	hc.probing.Store(enabled)
+}
+
+// ApplyStatus 应用外部（集群 leader）发布的节点健康状态，返回状态是否变化
+func (hc *HealthChecker) ApplyStatus(upstreamID, address string, status config.TargetStatus) bool {
+	hc.mu.RLock()
+	check, ok := hc.checks[upstreamID]
+	hc.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	return check.upstream.ApplyStatus(address, status)
+}
+
+// Statuses 获取所有启用主动检查的上游的节点健康状态 upstream_id -> address -> status
+func (hc *HealthChecker) Statuses() map[string]map[string]config.TargetStatus {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	statuses := make(map[string]map[string]config.TargetStatus, len(hc.checks))
+	for id, check := range hc.checks {
+		targets := make(map[string]config.TargetStatus)
+		for _, state := range check.upstream.TargetStates() {
+			targets[state.Address] = state.Status
+		}
+		statuses[id] = targets
+	}
+	return statuses
+}
+
+// Start 启动健康检查，为已注册的上游开始调度探测
 func (hc *HealthChecker) Start() {
-	go hc.runHealthCheckLoop()
+	hc.mu.Lock()
+	hc.started = true
+	for _, check := range hc.checks {
+		hc.schedule(check)
+	}
+	hc.mu.Unlock()
+
 	hc.logger.Info("health checker started")
 }
 
@@ -44,154 +105,191 @@ func (hc *HealthChecker) Stop() {
 	hc.logger.Info("health checker stopped")
 }
 
-// AddUpstream 添加上游服务到健康检查
+// AddUpstream 添加或更新上游服务的健康检查
+// 检查间隔不变时沿用原有调度，只替换上游配置
 func (hc *HealthChecker) AddUpstream(upstream *config.Upstream) {
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
-	hc.upstreams[upstream.ID] = upstream
+
+	old, ok := hc.checks[upstream.ID]
+	if upstream.HealthCheck == nil || !upstream.HealthCheck.Enabled {
+		if ok {
+			hc.unschedule(old)
+			delete(hc.checks, upstream.ID)
+		}
+		return
+	}
+
+	interval := time.Duration(upstream.HealthCheck.Interval) * time.Second
+	if ok && old.interval == interval {
+		old.upstream = upstream
+		select {
+		case old.unknown <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if ok {
+		hc.unschedule(old)
+	}
+
+	check := &upstreamCheck{upstream: upstream, interval: interval, unknown: make(chan struct{}, 1)}
+	hc.checks[upstream.ID] = check
+	if hc.started {
+		hc.schedule(check)
+	}
 }
 
 // RemoveUpstream 移除上游服务
 func (hc *HealthChecker) RemoveUpstream(upstreamID string) {
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
-	delete(hc.upstreams, upstreamID)
+
+	if check, ok := hc.checks[upstreamID]; ok {
+		hc.unschedule(check)
+		delete(hc.checks, upstreamID)
+	}
+}
+
+// schedule 启动上游的探测协程（调用方需持有锁）
+func (hc *HealthChecker) schedule(check *upstreamCheck) {
+	ctx, cancel := context.WithCancel(hc.ctx)
+	check.cancel = cancel
+	go hc.runCheckLoop(ctx, check)
+}
+
+// unschedule 停止上游的探测协程（调用方需持有锁）
+func (hc *HealthChecker) unschedule(check *upstreamCheck) {
+	if check.cancel != nil {
+		check.cancel()
+	}
 }
 
-// runHealthCheckLoop 健康检查循环
-func (hc *HealthChecker) runHealthCheckLoop() {
-	ticker := time.NewTicker(5 * time.Second) // 默认 5 秒检查一次
-	defer ticker.Stop()
+// runCheckLoop 按检查间隔周期探测上游的全部节点
+// 未知状态的节点（启动、新上游、新节点）立即探测，尽快确认其状态；
+// 全量探测的首次执行在一个间隔内随机延迟，之后每次间隔随机抖动
+func (hc *HealthChecker) runCheckLoop(ctx context.Context, check *upstreamCheck) {
+	hc.checkUnknown(ctx, check)
+
+	timer := time.NewTimer(time.Duration(rand.Int64N(int64(check.interval) + 1)))
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-hc.ctx.Done():
+		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			hc.checkAllUpstreams()
+		case <-check.unknown:
+			hc.checkUnknown(ctx, check)
+			continue
+		case <-timer.C:
+		}
+
+		if hc.probing.Load() {
+			hc.checkTargets(ctx, hc.upstreamOf(check), nil)
 		}
+
+		timer.Reset(jitter(check.interval))
 	}
 }
 
-// checkAllUpstreams 检查所有上游服务
-func (hc *HealthChecker) checkAllUpstreams() {
+// upstreamOf 获取探测任务当前的上游配置
+func (hc *HealthChecker) upstreamOf(check *upstreamCheck) *config.Upstream {
 	hc.mu.RLock()
-	upstreams := make([]*config.Upstream, 0, len(hc.upstreams))
-	for _, u := range hc.upstreams {
-		upstreams = append(upstreams, u)
+	defer hc.mu.RUnlock()
+	return check.upstream
+}
+
+// checkUnknown 立即探测上游中状态未知的节点
+func (hc *HealthChecker) checkUnknown(ctx context.Context, check *upstreamCheck) {
+	if !hc.probing.Load() {
+		return
 	}
-	hc.mu.RUnlock()
+	upstream := hc.upstreamOf(check)
+	unknown := make(map[string]bool)
+	for _, state := range upstream.TargetStates() {
+		if state.Status == config.TargetStatusUnknown {
+			unknown[state.Address] = true
+		}
+	}
+	if len(unknown) == 0 {
+		return
+	}
+	hc.checkTargets(ctx, upstream, func(target *config.Target) bool {
+		return unknown[target.Address]
+	})
+}
+
+// jitter 在 d 的基础上随机增减至多 healthCheckJitter 比例
+func jitter(d time.Duration) time.Duration {
+	delta := float64(d) * healthCheckJitter
+	return d + time.Duration((rand.Float64()*2-1)*delta)
+}
 
-	// 并发检查
+// checkTargets 并发检查上游的节点，filter 为 nil 时检查全部节点
+func (hc *HealthChecker) checkTargets(ctx context.Context, upstream *config.Upstream, filter func(*config.Target) bool) {
 	var wg sync.WaitGroup
-	for _, upstream := range upstreams {
-		if upstream.HealthCheck == nil || !upstream.HealthCheck.Enabled {
+	for _, target := range upstream.AllTargets() {
+		if filter != nil && !filter(target) {
 			continue
 		}
-
 		wg.Add(1)
-		go func(u *config.Upstream) {
+		go func(target *config.Target) {
 			defer wg.Done()
-			hc.checkUpstream(u)
-		}(upstream)
+			result := hc.checkTarget(ctx, upstream, target)
+			if ctx.Err() != nil {
+				return // 上游已移除或调度已变更，丢弃本轮结果
+			}
+			hc.reportProbe(upstream, target, result)
+		}(target)
 	}
 	wg.Wait()
 }
 
-// checkUpstream 检查单个上游服务
-func (hc *HealthChecker) checkUpstream(upstream *config.Upstream) {
-	for _, target := range upstream.Targets {
-		// 跳过已知不健康的节点（避免频繁检查）
-		if time.Since(target.LastCheckAt) < time.Duration(upstream.HealthCheck.Interval)*time.Second {
-			continue
-		}
-
-		healthy := hc.checkTarget(upstream, target)
-		hc.updateTargetStatus(upstream, target, healthy)
-	}
-}
-
-// checkTarget 检查单个目标节点
-func (hc *HealthChecker) checkTarget(upstream *config.Upstream, target *config.Target) bool {
-	ctx, cancel := context.WithTimeout(hc.ctx, time.Duration(upstream.HealthCheck.Timeout)*time.Second)
+// checkTarget 检查单个目标节点，返回探测耗时和失败原因
+func (hc *HealthChecker) checkTarget(ctx context.Context, upstream *config.Upstream, target *config.Target) config.ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(upstream.HealthCheck.Timeout)*time.Second)
 	defer cancel()
 
+	start := time.Now()
+	var err error
 	switch upstream.HealthCheck.Type {
-	case "http", "":
-		return hc.checkHTTP(ctx, upstream, target)
-	case "tcp":
-		return hc.checkTCP(ctx, target)
+	case config.HealthCheckHTTP, "":
+		err = checkHTTP(ctx, upstream.HealthCheck, target)
+	case config.HealthCheckTCP:
+		err = checkTCP(ctx, upstream.HealthCheck, target)
+	case config.HealthCheckGRPC:
+		err = checkGRPC(ctx, upstream.HealthCheck, target)
 	default:
-		hc.logger.Warn("unsupported health check type",
-			zap.String("type", upstream.HealthCheck.Type),
-			zap.String("upstream", upstream.ID))
-		return false
-	}
-}
-
-// checkHTTP HTTP 健康检查
-func (hc *HealthChecker) checkHTTP(ctx context.Context, upstream *config.Upstream, target *config.Target) bool {
-	url := fmt.Sprintf("http://%s%s", target.Address, upstream.HealthCheck.Path)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return false
+		err = fmt.Errorf("unsupported health check type: %s", upstream.HealthCheck.Type)
 	}
-
-	client := &http.Client{
-		Timeout: time.Duration(upstream.HealthCheck.Timeout) * time.Second,
-	}
-
-	resp, err := client.Do(req)
 	if err != nil {
 		hc.logger.Debug("health check failed",
 			zap.String("upstream", upstream.ID),
 			zap.String("target", target.Address),
 			zap.Error(err))
-		return false
 	}
-	defer resp.Body.Close()
-
-	// 2xx 或 3xx 状态码认为健康
-	return resp.StatusCode >= 200 && resp.StatusCode < 400
+	return config.ProbeResult{Latency: time.Since(start), Err: err}
 }
 
-// checkTCP TCP 健康检查（简化实现）
-func (hc *HealthChecker) checkTCP(ctx context.Context, target *config.Target) bool {
-	// TODO: 实现 TCP 连接检查
-	return true
-}
-
-// updateTargetStatus 更新目标节点状态
-func (hc *HealthChecker) updateTargetStatus(upstream *config.Upstream, target *config.Target, healthy bool) {
-	target.LastCheckAt = time.Now()
-
-	if healthy {
-		target.FailCount = 0
-		if target.Status != config.TargetStatusHealthy {
-			// 需要连续成功 N 次才标记为健康
-			if target.FailCount <= -upstream.HealthCheck.HealthyThreshold {
-				upstream.UpdateTargetStatus(target.Address, config.TargetStatusHealthy)
-				hc.logger.Info("target became healthy",
-					zap.String("upstream", upstream.ID),
-					zap.String("target", target.Address))
-			} else {
-				target.FailCount--
-			}
-		}
-	} else {
-		target.FailCount++
-		target.LastFailAt = time.Now()
-
-		if target.Status != config.TargetStatusUnhealthy {
-			// 连续失败 N 次后标记为不健康
-			if target.FailCount >= upstream.HealthCheck.UnhealthyThreshold {
-				upstream.UpdateTargetStatus(target.Address, config.TargetStatusUnhealthy)
-				hc.logger.Warn("target became unhealthy",
-					zap.String("upstream", upstream.ID),
-					zap.String("target", target.Address),
-					zap.Int("fail_count", target.FailCount))
-			}
-		}
+// reportProbe 上报探测结果并记录节点健康状态变化
+func (hc *HealthChecker) reportProbe(upstream *config.Upstream, target *config.Target, result config.ProbeResult) {
+	effect := upstream.ReportProbe(target.Address, result)
+	if !effect.Changed {
+		return
+	}
+	if hc.onChange != nil {
+		hc.onChange(upstream.ID, target.Address, effect.Status)
+	}
+	if effect.Status == config.TargetStatusHealthy {
+		hc.logger.Info("target became healthy",
+			zap.String("upstream", upstream.ID),
+			zap.String("target", target.Address),
+			zap.Int("success_count", effect.SuccessCount))
+		return
 	}
+	hc.logger.Warn("target became unhealthy",
+		zap.String("upstream", upstream.ID),
+		zap.String("target", target.Address),
+		zap.Int("fail_count", effect.FailCount),
+		zap.Error(result.Err))
 }
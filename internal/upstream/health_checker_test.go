@@ -0,0 +1,78 @@
+package upstream
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+func listen(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func newCheckedUpstream(t *testing.T, targets ...*config.Target) *config.Upstream {
+	t.Helper()
+	upstream := &config.Upstream{
+		ID:          "u1",
+		Type:        config.LoadBalanceRoundRobin,
+		Targets:     targets,
+		HealthCheck: &config.HealthCheck{Enabled: true, Type: config.HealthCheckTCP, Interval: 3600, Timeout: 1},
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return upstream
+}
+
+func waitHealthy(t *testing.T, upstream *config.Upstream, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(upstream.GetHealthyTargets()) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d targets available, want %d", len(upstream.GetHealthyTargets()), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 未知状态节点不等待探测间隔，首次探测成功即可用
+func TestUnknownTargetsProbedImmediately(t *testing.T) {
+	first, second := listen(t), listen(t)
+
+	hc := NewHealthChecker(zap.NewNop())
+	hc.Start()
+	defer hc.Stop()
+
+	upstream := newCheckedUpstream(t, &config.Target{Address: first})
+	if got := len(upstream.GetHealthyTargets()); got != 0 {
+		t.Fatalf("unknown target available before the first probe")
+	}
+	hc.AddUpstream(upstream)
+	waitHealthy(t, upstream, 1)
+
+	// 更新上游（检查间隔不变）新增的节点同样立即探测
+	updated := newCheckedUpstream(t,
+		&config.Target{Address: first, Status: config.TargetStatusHealthy},
+		&config.Target{Address: second})
+	hc.AddUpstream(updated)
+	waitHealthy(t, updated, 2)
+}
@@ -0,0 +1,191 @@
+package upstream
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// OutlierDetector 异常节点检测器
+// 周期性比较同一上游内各节点的成功率和延迟，摘除明显偏离同伴的节点
+type OutlierDetector struct {
+	upstreams map[string]*config.Upstream
+	lastRun   map[string]time.Time
+	logger    *zap.Logger
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mu        sync.RWMutex
+}
+
+// NewOutlierDetector 创建异常节点检测器
+func NewOutlierDetector(logger *zap.Logger) *OutlierDetector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &OutlierDetector{
+		upstreams: make(map[string]*config.Upstream),
+		lastRun:   make(map[string]time.Time),
+		logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start 启动异常检测
+func (od *OutlierDetector) Start() {
+	go od.runDetectLoop()
+	od.logger.Info("outlier detector started")
+}
+
+// Stop 停止异常检测
+func (od *OutlierDetector) Stop() {
+	od.cancel()
+	od.logger.Info("outlier detector stopped")
+}
+
+// AddUpstream 添加上游服务到异常检测
+func (od *OutlierDetector) AddUpstream(upstream *config.Upstream) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	od.upstreams[upstream.ID] = upstream
+}
+
+// RemoveUpstream 移除上游服务
+func (od *OutlierDetector) RemoveUpstream(upstreamID string) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	delete(od.upstreams, upstreamID)
+	delete(od.lastRun, upstreamID)
+}
+
+// runDetectLoop 检测循环，每秒检查一次哪些上游到达检测周期
+func (od *OutlierDetector) runDetectLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-od.ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, upstream := range od.dueUpstreams(now) {
+				od.detect(upstream)
+			}
+		}
+	}
+}
+
+// dueUpstreams 获取到达检测周期的上游
+func (od *OutlierDetector) dueUpstreams(now time.Time) []*config.Upstream {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	due := make([]*config.Upstream, 0)
+	for id, upstream := range od.upstreams {
+		if upstream.OutlierDetection == nil || !upstream.OutlierDetection.Enabled {
+			continue
+		}
+		interval := time.Duration(upstream.OutlierDetection.Interval) * time.Second
+		if now.Sub(od.lastRun[id]) < interval {
+			continue
+		}
+		od.lastRun[id] = now
+		due = append(due, upstream)
+	}
+	return due
+}
+
+// detect 对单个上游执行一轮检测
+func (od *OutlierDetector) detect(upstream *config.Upstream) {
+	for _, address := range upstream.ReinstateExpired() {
+		od.logger.Info("outlier target reinstated",
+			zap.String("upstream", upstream.ID),
+			zap.String("target", address))
+	}
+
+	cfg := upstream.OutlierDetection
+	samples := make([]config.OutlierSample, 0)
+	for _, sample := range upstream.DrainOutlierSamples() {
+		if sample.Requests >= cfg.MinRequests {
+			samples = append(samples, sample)
+		}
+	}
+	if len(samples) < cfg.MinHosts {
+		return
+	}
+
+	for _, sample := range successRateOutliers(samples, cfg.SuccessRateStdevFactor) {
+		od.eject(upstream, sample, config.EjectionReasonSuccessRate)
+	}
+	if cfg.LatencyFactor > 0 {
+		for _, sample := range latencyOutliers(samples, cfg.LatencyFactor) {
+			od.eject(upstream, sample, config.EjectionReasonLatency)
+		}
+	}
+}
+
+// eject 摘除节点并记录日志
+func (od *OutlierDetector) eject(upstream *config.Upstream, sample config.OutlierSample, reason config.EjectionReason) {
+	ejection, ok := upstream.EjectTarget(sample.Address, reason)
+	if !ok {
+		return
+	}
+	od.logger.Warn("outlier target ejected",
+		zap.String("upstream", upstream.ID),
+		zap.String("target", sample.Address),
+		zap.String("reason", string(reason)),
+		zap.Int("requests", sample.Requests),
+		zap.Int("failures", sample.Failures),
+		zap.Duration("latency", sample.Latency),
+		zap.Int("ejection_count", ejection.EjectionCount),
+		zap.Time("ejected_until", ejection.EjectedUntil))
+}
+
+// successRateOutliers 成功率低于 均值-factor*标准差 的节点
+func successRateOutliers(samples []config.OutlierSample, factor float64) []config.OutlierSample {
+	rates := make([]float64, len(samples))
+	mean := 0.0
+	for i, sample := range samples {
+		rates[i] = float64(sample.Requests-sample.Failures) / float64(sample.Requests)
+		mean += rates[i]
+	}
+	mean /= float64(len(samples))
+
+	variance := 0.0
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(samples)))
+	threshold := mean - factor*stdev
+
+	outliers := make([]config.OutlierSample, 0)
+	for i, sample := range samples {
+		if rates[i] < threshold {
+			outliers = append(outliers, sample)
+		}
+	}
+	return outliers
+}
+
+// latencyOutliers 平均延迟超过同伴中位数 factor 倍的节点
+func latencyOutliers(samples []config.OutlierSample, factor float64) []config.OutlierSample {
+	latencies := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		latencies[i] = sample.Latency
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	median := latencies[len(latencies)/2]
+	threshold := time.Duration(float64(median) * factor)
+
+	outliers := make([]config.OutlierSample, 0)
+	for _, sample := range samples {
+		if median > 0 && sample.Latency > threshold {
+			outliers = append(outliers, sample)
+		}
+	}
+	return outliers
+}
@@ -0,0 +1,98 @@
+package upstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+	"go.uber.org/zap"
+)
+
+func sampleAddresses(samples []config.OutlierSample) []string {
+	addresses := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		addresses = append(addresses, sample.Address)
+	}
+	return addresses
+}
+
+func TestSuccessRateOutliers(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []int // 每个节点 100 个请求中的失败数
+		want     []string
+	}{
+		{name: "uniform", failures: []int{1, 1, 1, 1}, want: []string{}},
+		{name: "one bad host", failures: []int{0, 0, 0, 0, 50}, want: []string{"t4"}},
+		{name: "all failing equally", failures: []int{90, 90, 90}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := make([]config.OutlierSample, len(tt.failures))
+			for i, failures := range tt.failures {
+				samples[i] = config.OutlierSample{Address: fmt.Sprintf("t%d", i), Requests: 100, Failures: failures}
+			}
+			got := sampleAddresses(successRateOutliers(samples, 1.9))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("outliers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyOutliers(t *testing.T) {
+	samples := []config.OutlierSample{
+		{Address: "t0", Latency: 10 * time.Millisecond},
+		{Address: "t1", Latency: 12 * time.Millisecond},
+		{Address: "t2", Latency: 11 * time.Millisecond},
+		{Address: "t3", Latency: 80 * time.Millisecond},
+	}
+	got := sampleAddresses(latencyOutliers(samples, 3))
+	if fmt.Sprint(got) != "[t3]" {
+		t.Fatalf("outliers = %v, want [t3]", got)
+	}
+}
+
+func TestOutlierDetectorEjectsFailingTarget(t *testing.T) {
+	upstream := &config.Upstream{
+		ID:   "u1",
+		Type: config.LoadBalanceRoundRobin,
+		OutlierDetection: &config.OutlierDetection{
+			Enabled:                true,
+			MaxEjectionPercent:     50,
+			MinRequests:            10,
+			MinHosts:               3,
+			SuccessRateStdevFactor: 1,
+		},
+	}
+	for i := 0; i < 4; i++ {
+		upstream.Targets = append(upstream.Targets, &config.Target{
+			Address: fmt.Sprintf("10.0.0.%d:80", i+1),
+			Status:  config.TargetStatusHealthy,
+		})
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range upstream.Targets {
+		for i := 0; i < 20; i++ {
+			status := 200
+			if target.Address == "10.0.0.4:80" {
+				status = 503
+			}
+			upstream.ReportResult(target.Address, config.ProxyResult{StatusCode: status, Latency: time.Millisecond})
+		}
+	}
+
+	NewOutlierDetector(zap.NewNop()).detect(upstream)
+
+	ejections := upstream.Ejections()
+	if len(ejections) != 1 || ejections[0].Address != "10.0.0.4:80" {
+		t.Fatalf("ejections = %+v, want only 10.0.0.4:80", ejections)
+	}
+	if got := len(upstream.GetHealthyTargets()); got != 3 {
+		t.Fatalf("%d targets available, want 3", got)
+	}
+}
@@ -0,0 +1,142 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+// maxProbeBody 探测时读取的响应数据上限
+const maxProbeBody = 64 * 1024
+
+// checkHTTP HTTP 健康检查：校验状态码范围，配置了响应体条件时同时校验响应体
+func checkHTTP(ctx context.Context, check *config.HealthCheck, target *config.Target) error {
+	tlsConfig := check.TLSConfig()
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, check.Method, fmt.Sprintf("%s://%s%s", scheme, target.Address, check.Path), nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range check.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Host = target.Host()
+	if check.Host != "" {
+		req.Host = check.Host
+	}
+
+	// 每次探测使用新连接，反映节点当前能否建立连接
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: true,
+		},
+		// 不跟随重定向，3xx 按状态码判断
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !check.ExpectStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if check.ChecksBody() {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+		if err != nil {
+			return fmt.Errorf("read body: %w", err)
+		}
+		if !check.MatchBody(body) {
+			return errors.New("response body does not match")
+		}
+	}
+	return nil
+}
+
+// checkTCP TCP 健康检查：建立连接，配置了 Send/Expect 时发送数据并等待期望的响应
+func checkTCP(ctx context.Context, check *config.HealthCheck, target *config.Target) error {
+	var conn net.Conn
+	var err error
+	if tlsConfig := check.TLSConfig(); tlsConfig != nil {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", target.Address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", target.Address)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if check.Send != "" {
+		if _, err := conn.Write([]byte(check.Send)); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+	}
+	if check.Expect == "" {
+		return nil
+	}
+
+	// 持续读取直到收到期望内容、连接关闭或超时
+	expect := []byte(check.Expect)
+	received := make([]byte, 0, 512)
+	buf := make([]byte, 512)
+	for len(received) < maxProbeBody {
+		n, err := conn.Read(buf)
+		received = append(received, buf[:n]...)
+		if bytes.Contains(received, expect) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("expected response not received: %w", err)
+		}
+	}
+	return errors.New("expected response not received")
+}
+
+// checkGRPC gRPC 健康检查，使用 grpc.health.v1 协议，要求服务状态为 SERVING
+func checkGRPC(ctx context.Context, check *config.HealthCheck, target *config.Target) error {
+	creds := insecure.NewCredentials()
+	if tlsConfig := check.TLSConfig(); tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(target.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: check.Service})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpc health status %s", resp.Status)
+	}
+	return nil
+}
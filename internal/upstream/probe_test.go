@@ -0,0 +1,211 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/RunzhiZhao/long-gate/internal/config"
+)
+
+func newHealthCheck(t *testing.T, hc *config.HealthCheck) *config.HealthCheck {
+	t.Helper()
+	hc.Enabled = true
+	upstream := &config.Upstream{
+		ID:          "u1",
+		Type:        config.LoadBalanceRoundRobin,
+		Targets:     []*config.Target{{Address: "127.0.0.1:80"}},
+		HealthCheck: hc,
+	}
+	if err := upstream.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return hc
+}
+
+func TestCheckHTTPHost(t *testing.T) {
+	hosts := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name   string
+		host   string
+		target *config.Target
+		want   string
+	}{
+		{name: "target address", target: &config.Target{Address: address}, want: address},
+		{name: "dns hostname", target: &config.Target{Address: address, Metadata: map[string]string{config.MetadataHostname: "user.internal"}},
+			want: "user.internal:" + address[strings.LastIndex(address, ":")+1:]},
+		{name: "configured host", host: "health.internal", target: &config.Target{Address: address}, want: "health.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := newHealthCheck(t, &config.HealthCheck{Type: config.HealthCheckHTTP, Path: "/", Host: tt.host})
+			if err := checkHTTP(context.Background(), check, tt.target); err != nil {
+				t.Fatal(err)
+			}
+			if got := <-hosts; got != tt.want {
+				t.Fatalf("Host = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/method":
+			w.Write([]byte("method=" + r.Method))
+		case "/redirect":
+			http.Redirect(w, r, "/login", http.StatusFound)
+		case "/missing":
+			http.NotFound(w, r)
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status": "down"}`))
+		default:
+			w.Write([]byte(`{"status": "up", "version": "1.4.2"}`))
+		}
+	}))
+	defer server.Close()
+	target := &config.Target{Address: strings.TrimPrefix(server.URL, "http://")}
+
+	tests := []struct {
+		name    string
+		check   config.HealthCheck
+		healthy bool
+	}{
+		{name: "default statuses", check: config.HealthCheck{Path: "/"}, healthy: true},
+		{name: "redirect is healthy by default", check: config.HealthCheck{Path: "/redirect"}, healthy: true},
+		{name: "server error", check: config.HealthCheck{Path: "/down"}},
+		{name: "not found outside default range", check: config.HealthCheck{Path: "/missing"}},
+		{name: "expected single status", check: config.HealthCheck{Path: "/missing", ExpectedStatuses: []string{"200-299", "404"}}, healthy: true},
+		{name: "redirect outside expected range", check: config.HealthCheck{Path: "/redirect", ExpectedStatuses: []string{"200-299"}}},
+		{name: "method", check: config.HealthCheck{Path: "/method", Method: http.MethodPost, BodyContains: "method=POST"}, healthy: true},
+		{name: "default method", check: config.HealthCheck{Path: "/method", BodyContains: "method=GET"}, healthy: true},
+		{name: "body contains", check: config.HealthCheck{Path: "/", BodyContains: `"status": "up"`}, healthy: true},
+		{name: "body missing substring", check: config.HealthCheck{Path: "/", BodyContains: `"status": "down"`}},
+		{name: "body regex", check: config.HealthCheck{Path: "/", BodyRegex: `"version": "1\.\d+\.\d+"`}, healthy: true},
+		{name: "body regex mismatch", check: config.HealthCheck{Path: "/", BodyRegex: `"version": "2\.`}},
+		{name: "status checked before body", check: config.HealthCheck{Path: "/down", BodyContains: "status"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := tt.check
+			check.Type = config.HealthCheckHTTP
+			err := checkHTTP(context.Background(), newHealthCheck(t, &check), target)
+			if healthy := err == nil; healthy != tt.healthy {
+				t.Fatalf("healthy = %v (err: %v), want %v", healthy, err, tt.healthy)
+			}
+		})
+	}
+}
+
+// echoServer 回显收到的数据的 TCP 服务
+func echoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCheckTCP(t *testing.T) {
+	echo := echoServer(t)
+	closed := listen(t) // 接受连接后立即关闭
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name    string
+		address string
+		send    string
+		expect  string
+		healthy bool
+	}{
+		{name: "connect only", address: echo, healthy: true},
+		{name: "connection refused", address: refused},
+		{name: "send and expect", address: echo, send: "PING\r\n", expect: "PING", healthy: true},
+		{name: "unexpected response", address: echo, send: "PING\r\n", expect: "PONG"},
+		{name: "no response", address: echo, expect: "+OK"},
+		{name: "closed before response", address: closed, send: "PING\r\n", expect: "PING"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := newHealthCheck(t, &config.HealthCheck{Type: config.HealthCheckTCP, Send: tt.send, Expect: tt.expect})
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := checkTCP(ctx, check, &config.Target{Address: tt.address})
+			if healthy := err == nil; healthy != tt.healthy {
+				t.Fatalf("healthy = %v (err: %v), want %v", healthy, err, tt.healthy)
+			}
+		})
+	}
+}
+
+func TestCheckGRPC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("user.UserService", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("order.OrderService", healthpb.HealthCheckResponse_NOT_SERVING)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(ln)
+	defer server.Stop()
+
+	tests := []struct {
+		name    string
+		service string
+		healthy bool
+	}{
+		{name: "whole server", healthy: true},
+		{name: "serving service", service: "user.UserService", healthy: true},
+		{name: "not serving service", service: "order.OrderService"},
+		{name: "unknown service", service: "pay.PayService"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := newHealthCheck(t, &config.HealthCheck{Type: config.HealthCheckGRPC, Service: tt.service})
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err := checkGRPC(ctx, check, &config.Target{Address: ln.Addr().String()})
+			if healthy := err == nil; healthy != tt.healthy {
+				t.Fatalf("healthy = %v (err: %v), want %v", healthy, err, tt.healthy)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package registry 服务实例自注册客户端
+//
+// 服务实例在 ETCD 的发现前缀下以租约方式注册自身地址，网关中
+// discovery.type 为 etcd 的上游会根据注册信息自动维护节点列表：
+//
+//	reg, err := registry.Register(client, "user-service", registry.Instance{
+//		ID:      "user-1",
+//		Address: "10.0.0.1:8080",
+//	}, 10*time.Second)
+//	defer reg.Close()
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Prefix 服务发现 Key 前缀，完整 Key 为 Prefix + service + "/" + instance_id
+const Prefix = "/gateway/discovery/"
+
+// Instance 服务实例
+type Instance struct {
+	ID       string            `json:"id"`
+	Address  string            `json:"address"`            // host:port
+	Weight   int               `json:"weight,omitempty"`   // 1-100，默认 1
+	Priority int               `json:"priority,omitempty"` // 优先级，数字越小越优先
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Key 获取实例的注册 Key
+func Key(service, instanceID string) string {
+	return Prefix + service + "/" + instanceID
+}
+
+// Registration 一次服务注册，后台维持租约直到 Close
+type Registration struct {
+	client *clientv3.Client
+	key    string
+	value  string
+	ttl    time.Duration
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Register 以租约方式注册服务实例
+// 租约丢失（如与 ETCD 断连超过 TTL）后会自动重新注册
+func Register(client *clientv3.Client, service string, instance Instance, ttl time.Duration) (*Registration, error) {
+	if service == "" || instance.ID == "" || instance.Address == "" {
+		return nil, fmt.Errorf("service, instance id and address cannot be empty")
+	}
+	// 与网关静态节点的校验一致，不合法的实例会被网关忽略
+	if instance.Weight < 0 || instance.Weight > 100 {
+		return nil, fmt.Errorf("weight must be between 1 and 100")
+	}
+	if instance.Priority < 0 {
+		return nil, fmt.Errorf("priority cannot be negative")
+	}
+	if ttl < time.Second {
+		return nil, fmt.Errorf("ttl must be at least 1s")
+	}
+
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Registration{
+		client: client,
+		key:    Key(service, instance.ID),
+		value:  string(data),
+		ttl:    ttl,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	keepAlive, leaseID, err := r.register()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go r.run(keepAlive, leaseID)
+	return r, nil
+}
+
+// Close 注销实例并停止续约
+func (r *Registration) Close() error {
+	r.cancel()
+	<-r.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := r.client.Delete(ctx, r.key)
+	return err
+}
+
+// register 创建租约、写入实例信息并开始续约
+func (r *Registration) register() (<-chan *clientv3.LeaseKeepAliveResponse, clientv3.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, 5*time.Second)
+	defer cancel()
+
+	lease, err := r.client.Grant(ctx, int64(r.ttl/time.Second))
+	if err != nil {
+		return nil, 0, fmt.Errorf("grant lease: %w", err)
+	}
+	if _, err := r.client.Put(ctx, r.key, r.value, clientv3.WithLease(lease.ID)); err != nil {
+		return nil, 0, fmt.Errorf("put instance: %w", err)
+	}
+	keepAlive, err := r.client.KeepAlive(r.ctx, lease.ID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("keep alive: %w", err)
+	}
+	return keepAlive, lease.ID, nil
+}
+
+// run 消费续约响应，续约通道关闭时以指数退避重新注册
+func (r *Registration) run(keepAlive <-chan *clientv3.LeaseKeepAliveResponse, leaseID clientv3.LeaseID) {
+	defer close(r.done)
+
+	for {
+		for range keepAlive {
+		}
+
+		if r.ctx.Err() != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			r.client.Revoke(ctx, leaseID)
+			cancel()
+			return
+		}
+
+		backoff := time.Second
+		for {
+			var err error
+			keepAlive, leaseID, err = r.register()
+			if err == nil {
+				break
+			}
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < r.ttl {
+				backoff *= 2
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd 记录注册过程中的 ETCD 调用，续约通道可由测试关闭以模拟租约丢失
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Lease
+
+	mu      sync.Mutex
+	nextID  clientv3.LeaseID
+	puts    []string // key=value@lease
+	deletes []string
+	revoked []clientv3.LeaseID
+	stops   map[clientv3.LeaseID]func()
+	granted chan clientv3.LeaseID
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		stops:   make(map[clientv3.LeaseID]func()),
+		granted: make(chan clientv3.LeaseID, 10),
+	}
+}
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	return &clientv3.LeaseGrantResponse{ID: f.nextID, TTL: ttl}, nil
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.puts = append(f.puts, key+"="+val)
+	return &clientv3.PutResponse{}, nil
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deletes = append(f.deletes, key)
+	return &clientv3.DeleteResponse{}, nil
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked = append(f.revoked, id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+// KeepAlive 返回的通道在 ctx 取消或测试调用 lose 时关闭
+func (f *fakeEtcd) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	var once sync.Once
+	stop := func() { once.Do(func() { close(ch) }) }
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	f.mu.Lock()
+	f.stops[id] = stop
+	f.mu.Unlock()
+	f.granted <- id
+	return ch, nil
+}
+
+// lose 模拟租约丢失
+func (f *fakeEtcd) lose(id clientv3.LeaseID) {
+	f.mu.Lock()
+	stop := f.stops[id]
+	f.mu.Unlock()
+	stop()
+}
+
+func (f *fakeEtcd) waitLease(t *testing.T) clientv3.LeaseID {
+	t.Helper()
+	select {
+	case id := <-f.granted:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("lease not kept alive")
+		return 0
+	}
+}
+
+func TestRegister(t *testing.T) {
+	etcd := newFakeEtcd()
+	client := &clientv3.Client{KV: etcd, Lease: etcd}
+	instance := Instance{ID: "user-1", Address: "10.0.0.1:8080", Weight: 10}
+
+	reg, err := Register(client, "user-service", instance, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := etcd.waitLease(t)
+
+	// 租约丢失后立即以新租约重新注册
+	etcd.lose(first)
+	if second := etcd.waitLease(t); second == first {
+		t.Fatalf("re-registered with the lost lease %d", first)
+	}
+
+	if err := reg.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	etcd.mu.Lock()
+	defer etcd.mu.Unlock()
+	want := `/gateway/discovery/user-service/user-1={"id":"user-1","address":"10.0.0.1:8080","weight":10}`
+	if len(etcd.puts) != 2 || etcd.puts[0] != want || etcd.puts[1] != want {
+		t.Fatalf("puts = %q, want the instance registered twice", etcd.puts)
+	}
+	if len(etcd.revoked) != 1 || etcd.revoked[0] != 2 {
+		t.Fatalf("revoked = %v, want the current lease", etcd.revoked)
+	}
+	if len(etcd.deletes) != 1 || etcd.deletes[0] != Key("user-service", "user-1") {
+		t.Fatalf("deletes = %q, want the instance key", etcd.deletes)
+	}
+}
+
+func TestRegisterValidate(t *testing.T) {
+	valid := Instance{ID: "user-1", Address: "10.0.0.1:8080"}
+	tests := []struct {
+		name     string
+		service  string
+		instance func(i *Instance)
+		ttl      time.Duration
+	}{
+		{name: "empty service", instance: func(i *Instance) {}},
+		{name: "empty id", service: "user-service", instance: func(i *Instance) { i.ID = "" }},
+		{name: "empty address", service: "user-service", instance: func(i *Instance) { i.Address = "" }},
+		{name: "weight above 100", service: "user-service", instance: func(i *Instance) { i.Weight = 101 }},
+		{name: "negative priority", service: "user-service", instance: func(i *Instance) { i.Priority = -1 }},
+		{name: "ttl below 1s", service: "user-service", instance: func(i *Instance) {}, ttl: 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := valid
+			tt.instance(&instance)
+			ttl := tt.ttl
+			if ttl == 0 {
+				ttl = 5 * time.Second
+			}
+			if _, err := Register(nil, tt.service, instance, ttl); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}